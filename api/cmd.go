@@ -1,15 +1,28 @@
 package api
 
 import (
-	"os"
-	"path/filepath"
+	"encoding/json"
 
 	"github.com/gin-gonic/gin"
+	"github.com/steeve/pulsar/cache"
 	"github.com/steeve/pulsar/config"
 	"github.com/steeve/pulsar/xbmc"
 )
 
-func ClearCache(ctx *gin.Context) {
-	os.RemoveAll(filepath.Join(config.Get().Info.Profile, "cache"))
-	xbmc.Notify("Pulsar", "Cache cleared", config.AddonIcon())
+func ClearCache(store cache.CacheStore) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if err := store.Flush(); err != nil {
+			xbmc.Notify("Pulsar", "Unable to clear the cache", config.AddonIcon())
+			return
+		}
+		xbmc.Notify("Pulsar", "Cache cleared", config.AddonIcon())
+	}
+}
+
+func CacheStats(ctx *gin.Context) {
+	data, err := json.MarshalIndent(cache.GetPageCacheStats(), "", "    ")
+	if err != nil {
+		ctx.Error(err)
+	}
+	ctx.Data(200, "application/json", data)
 }
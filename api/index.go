@@ -23,5 +23,6 @@ func Index(ctx *gin.Context) {
 
 		{Label: "Search", Path: UrlForXBMC("/search"), Thumbnail: config.AddonResource("img", "search.png")},
 		{Label: "Paste URL", Path: UrlForXBMC("/pasted"), Thumbnail: config.AddonResource("img", "magnet.png")},
+		{Label: "Providers", Path: UrlForXBMC("/providers/")},
 	}))
 }
@@ -3,10 +3,10 @@ package api
 import (
 	"fmt"
 	"log"
-	"sort"
 	"strconv"
 	"strings"
 
+	"github.com/dustin/go-humanize"
 	"github.com/gin-gonic/gin"
 	"github.com/steeve/pulsar/bittorrent"
 	"github.com/steeve/pulsar/config"
@@ -131,7 +131,7 @@ func MovieGenres(ctx *gin.Context) {
 	ctx.JSON(200, xbmc.NewView("", items))
 }
 
-func movieLinks(imdbId string) []*bittorrent.Torrent {
+func movieSearchers(imdbId string) (*tmdb.Movie, []providers.MovieSearcher) {
 	log.Println("Searching links for IMDB:", imdbId)
 
 	movie := tmdb.GetMovieFromIMDB(imdbId, config.Get().Language)
@@ -143,16 +143,22 @@ func movieLinks(imdbId string) []*bittorrent.Torrent {
 		xbmc.Notify("Pulsar", "Unable to find any providers", config.AddonIcon())
 	}
 
-	return providers.SearchMovie(searchers, movie)
+	return movie, searchers
+}
+
+func movieLinks(imdbId string) (*tmdb.Movie, []*bittorrent.Torrent) {
+	movie, searchers := movieSearchers(imdbId)
+	return movie, providers.SearchMovie(searchers, movie)
 }
 
 func MovieLinks(ctx *gin.Context) {
-	torrents := movieLinks(ctx.Params.ByName("imdbId"))
+	_, torrents := movieLinks(ctx.Params.ByName("imdbId"))
 
 	if len(torrents) == 0 {
 		xbmc.Notify("Pulsar", "No links were found", config.AddonIcon())
 		return
 	}
+	providers.GetQualityProfile().Sort(torrents)
 
 	choices := make([]string, 0, len(torrents))
 	for _, torrent := range torrents {
@@ -169,6 +175,8 @@ func MovieLinks(ctx *gin.Context) {
 		if torrent.AudioCodec > 0 {
 			info = append(info, bittorrent.Codecs[torrent.AudioCodec])
 		}
+		info = append(info, sizeInfo(torrent)...)
+		info = append(info, languageInfo(torrent)...)
 
 		label := fmt.Sprintf("S:%d P:%d - %s - %s",
 			torrent.Seeds,
@@ -186,13 +194,41 @@ func MovieLinks(ctx *gin.Context) {
 	}
 }
 
-func MoviePlay(ctx *gin.Context) {
-	torrents := movieLinks(ctx.Params.ByName("imdbId"))
-	if len(torrents) == 0 {
-		xbmc.Notify("Pulsar", "No links were found", config.AddonIcon())
-		return
+// sizeInfo returns the size and implied bitrate of torrent, for labels.
+func sizeInfo(torrent *bittorrent.Torrent) []string {
+	info := make([]string, 0)
+	if torrent.Size > 0 {
+		info = append(info, humanize.Bytes(uint64(torrent.Size)))
+	}
+	if torrent.Bitrate > 0 {
+		info = append(info, fmt.Sprintf("%.1f Mbps", float64(torrent.Bitrate)/1e6))
 	}
-	sort.Sort(sort.Reverse(providers.ByQuality(torrents)))
-	rUrl := UrlQuery(UrlForXBMC("/play"), "uri", torrents[0].Magnet())
-	ctx.Redirect(302, rUrl)
+	if torrent.IsOversized {
+		info = append(info, "(oversized)")
+	}
+	return info
+}
+
+// languageInfo returns the audio and subtitles languages of torrent, for
+// labels.
+func languageInfo(torrent *bittorrent.Torrent) []string {
+	info := make([]string, 0)
+	for _, language := range torrent.Languages() {
+		info = append(info, strings.ToUpper(language))
+	}
+	if torrent.Release == nil {
+		return info
+	}
+	if len(torrent.Release.Subtitles) > 0 {
+		info = append(info, "Subs:"+strings.ToUpper(strings.Join(torrent.Release.Subtitles, ",")))
+	}
+	if torrent.Release.Hardcoded {
+		info = append(info, "(hardcoded subs)")
+	}
+	return info
+}
+
+func MoviePlay(ctx *gin.Context) {
+	movie, searchers := movieSearchers(ctx.Params.ByName("imdbId"))
+	playFromStream(ctx, providers.StreamMovie(searchers, movie), movie.Runtime)
 }
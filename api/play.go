@@ -2,7 +2,9 @@ package api
 
 import (
 	"fmt"
+	"log"
 	"net/url"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"github.com/steeve/pulsar/bittorrent"
@@ -25,6 +27,10 @@ func Play(btService *bittorrent.BTService) gin.HandlerFunc {
 		}
 		magnet += "&" + boosters.Encode()
 		player := bittorrent.NewBTPlayer(btService, magnet, config.Get().KeepFilesAfterStop == false)
+		if episode, _ := strconv.Atoi(ctx.Request.URL.Query().Get("episode")); episode > 0 {
+			season, _ := strconv.Atoi(ctx.Request.URL.Query().Get("season"))
+			player.SelectEpisode(season, episode)
+		}
 		if player.Buffer() != nil {
 			return
 		}
@@ -44,3 +50,31 @@ func PasteURL(ctx *gin.Context) {
 	}
 	xbmc.PlayURL(UrlQuery(UrlForXBMC("/play"), "uri", magnet))
 }
+
+// playFromStream plays the best link of the search according to the quality
+// profile. It doesn't wait for the slow providers if a good enough link was
+// found by the fast ones.
+func playFromStream(ctx *gin.Context, stream *providers.SearchStream, runtime int) {
+	defer stream.Close()
+	profile := providers.GetQualityProfile()
+
+	torrents := make([]*bittorrent.Torrent, 0)
+	for results := range stream.Results {
+		torrents = append(torrents, results...)
+		if selected := profile.Select(results, runtime); len(selected) > 0 && profile.IsGoodEnough(selected[0], runtime) {
+			log.Println("Found a good enough link, not waiting for the other providers")
+			break
+		}
+	}
+	if len(torrents) == 0 {
+		xbmc.Notify("Pulsar", "No links were found", config.AddonIcon())
+		return
+	}
+	torrents = profile.Select(torrents, runtime)
+	if len(torrents) == 0 {
+		xbmc.Notify("Pulsar", "No links match your quality profile", config.AddonIcon())
+		return
+	}
+	rUrl := UrlQuery(UrlForXBMC("/play"), "uri", torrents[0].Magnet())
+	ctx.Redirect(302, rUrl)
+}
@@ -12,8 +12,9 @@ import (
 )
 
 type providerDebugResponse struct {
-	Payload interface{} `json:"payload"`
-	Results interface{} `json:"results"`
+	Payload   interface{} `json:"payload"`
+	Results   interface{} `json:"results"`
+	Discarded interface{} `json:"discarded,omitempty"`
 }
 
 func ProviderGetMovie(ctx *gin.Context) {
@@ -24,15 +25,16 @@ func ProviderGetMovie(ctx *gin.Context) {
 	log.Printf("Resolved %s to %s\n", imdbId, movie.Title)
 
 	searcher := providers.NewAddonSearcher(provider)
-	torrents := searcher.SearchMovieLinks(movie)
+	torrents, discarded := searcher.SearchMovieLinksDiscarded(movie)
 	if ctx.Request.URL.Query().Get("resolve") == "true" {
 		for _, torrent := range torrents {
 			torrent.Resolve()
 		}
 	}
 	data, err := json.MarshalIndent(providerDebugResponse{
-		Payload: searcher.GetMovieSearchObject(movie),
-		Results: torrents,
+		Payload:   searcher.GetMovieSearchObject(movie),
+		Results:   torrents,
+		Discarded: discarded,
 	}, "", "    ")
 	if err != nil {
 		ctx.Error(err)
@@ -73,3 +75,15 @@ func ProviderGetEpisode(ctx *gin.Context) {
 	}
 	ctx.Data(200, "application/json", data)
 }
+
+func ProviderConformance(ctx *gin.Context) {
+	provider := ctx.Params.ByName("provider")
+	log.Println("Running conformance fixtures against", provider)
+
+	report := providers.RunConformance(provider, providers.GetProvider(provider), providers.DefaultConformanceFixtures())
+	data, err := json.MarshalIndent(report, "", "    ")
+	if err != nil {
+		ctx.Error(err)
+	}
+	ctx.Data(200, "application/json", data)
+}
@@ -0,0 +1,77 @@
+package api
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/steeve/pulsar/config"
+	"github.com/steeve/pulsar/providers"
+	"github.com/steeve/pulsar/xbmc"
+)
+
+func providerNames() []string {
+	return append(providers.GetAddonProviders(), providers.Registered()...)
+}
+
+func ProvidersList(ctx *gin.Context) {
+	names := providerNames()
+	items := make(xbmc.ListItems, 0, len(names))
+	for _, name := range names {
+		stats := providers.GetProviderStats(name)
+		label := name
+		if stats.Disabled {
+			label += " (disabled)"
+		}
+		label2 := "Never used"
+		if stats.Searches > 0 {
+			label2 = fmt.Sprintf("%d searches, %.0f%% failed, %dms, %.1f results",
+				stats.Searches,
+				stats.FailureRate()*100,
+				stats.AverageLatencyMs,
+				stats.AverageResults,
+			)
+		}
+		items = append(items, &xbmc.ListItem{
+			Label:  label,
+			Label2: label2,
+			Path:   UrlForXBMC("/provider/%s/manage", name),
+		})
+	}
+
+	ctx.JSON(200, xbmc.NewView("", items))
+}
+
+func ProvidersStats(ctx *gin.Context) {
+	ctx.JSON(200, providers.GetProvidersStats())
+}
+
+func ProviderManage(ctx *gin.Context) {
+	name := ctx.Params.ByName("provider")
+	stats := providers.GetProviderStats(name)
+
+	toggle := "Disable"
+	if stats.Disabled {
+		toggle = "Enable"
+	}
+	timeout := "Set timeout (default)"
+	if stats.Timeout > 0 {
+		timeout = fmt.Sprintf("Set timeout (%ds)", stats.Timeout)
+	}
+
+	switch xbmc.ListDialog(name, toggle, timeout, "Reset statistics") {
+	case 0:
+		providers.SetProviderEnabled(name, stats.Disabled)
+		xbmc.Notify("Pulsar", fmt.Sprintf("%sd %s", toggle, name), config.AddonIcon())
+	case 1:
+		input := xbmc.Keyboard(strconv.Itoa(stats.Timeout), "Timeout in seconds (0 for default)")
+		if input == "" {
+			return
+		}
+		if seconds, err := strconv.Atoi(input); err == nil && seconds >= 0 {
+			providers.SetProviderTimeout(name, seconds)
+		}
+	case 2:
+		providers.ResetProviderStats(name)
+	}
+}
@@ -21,6 +21,14 @@ const (
 	RepositoryCacheTime = 20 * time.Minute
 	EpisodesCacheTime   = 15 * time.Minute
 	IndexCacheTime      = 15 * 24 * time.Hour // 15 days caching for index
+
+	// how long expired pages are still served while they are refreshed
+	IndexStaleTime    = 7 * 24 * time.Hour
+	ListingsStaleTime = 1 * time.Hour
+	EpisodesStaleTime = 5 * time.Minute
+
+	// hot pages are also kept in memory
+	MemoryCacheEntries = 200
 )
 
 func Routes(btService *bittorrent.BTService) *gin.Engine {
@@ -30,7 +38,11 @@ func Routes(btService *bittorrent.BTService) *gin.Engine {
 
 	r.Use(ga.GATracker())
 
-	store := cache.NewFileStore(path.Join(config.Get().ProfilePath, "cache"))
+	store := cache.NewTieredStore(
+		cache.NewMemoryStore(MemoryCacheEntries),
+		cache.NewFileStore(path.Join(config.Get().ProfilePath, "cache")),
+		EpisodesCacheTime,
+	)
 
 	r.GET("/", Index)
 	r.GET("/search", Search)
@@ -38,14 +50,14 @@ func Routes(btService *bittorrent.BTService) *gin.Engine {
 
 	movies := r.Group("/movies")
 	{
-		movies.GET("/", cache.Cache(store, IndexCacheTime), MoviesIndex)
+		movies.GET("/", cache.Cache(store, IndexCacheTime, IndexStaleTime), MoviesIndex)
 		movies.GET("/search", SearchMovies)
-		movies.GET("/popular", cache.Cache(store, DefaultCacheTime), PopularMovies)
-		movies.GET("/popular/:genre", cache.Cache(store, DefaultCacheTime), PopularMovies)
-		movies.GET("/top", cache.Cache(store, DefaultCacheTime), TopRatedMovies)
-		movies.GET("/imdb250", cache.Cache(store, DefaultCacheTime), IMDBTop250)
-		movies.GET("/mostvoted", cache.Cache(store, DefaultCacheTime), MoviesMostVoted)
-		movies.GET("/genres", cache.Cache(store, IndexCacheTime), MovieGenres)
+		movies.GET("/popular", cache.Cache(store, DefaultCacheTime, ListingsStaleTime), PopularMovies)
+		movies.GET("/popular/:genre", cache.Cache(store, DefaultCacheTime, ListingsStaleTime), PopularMovies)
+		movies.GET("/top", cache.Cache(store, DefaultCacheTime, ListingsStaleTime), TopRatedMovies)
+		movies.GET("/imdb250", cache.Cache(store, DefaultCacheTime, ListingsStaleTime), IMDBTop250)
+		movies.GET("/mostvoted", cache.Cache(store, DefaultCacheTime, ListingsStaleTime), MoviesMostVoted)
+		movies.GET("/genres", cache.Cache(store, IndexCacheTime, IndexStaleTime), MovieGenres)
 	}
 	movie := r.Group("/movie")
 	{
@@ -55,18 +67,19 @@ func Routes(btService *bittorrent.BTService) *gin.Engine {
 
 	shows := r.Group("/shows")
 	{
-		shows.GET("/", cache.Cache(store, IndexCacheTime), TVIndex)
+		shows.GET("/", cache.Cache(store, IndexCacheTime, IndexStaleTime), TVIndex)
 		shows.GET("/search", SearchShows)
-		shows.GET("/popular", cache.Cache(store, DefaultCacheTime), PopularShows)
-		shows.GET("/popular/:genre", cache.Cache(store, DefaultCacheTime), PopularShows)
-		shows.GET("/top", cache.Cache(store, DefaultCacheTime), TopRatedShows)
-		shows.GET("/mostvoted", cache.Cache(store, DefaultCacheTime), TVMostVoted)
-		shows.GET("/genres", cache.Cache(store, IndexCacheTime), TVGenres)
+		shows.GET("/popular", cache.Cache(store, DefaultCacheTime, ListingsStaleTime), PopularShows)
+		shows.GET("/popular/:genre", cache.Cache(store, DefaultCacheTime, ListingsStaleTime), PopularShows)
+		shows.GET("/top", cache.Cache(store, DefaultCacheTime, ListingsStaleTime), TopRatedShows)
+		shows.GET("/mostvoted", cache.Cache(store, DefaultCacheTime, ListingsStaleTime), TVMostVoted)
+		shows.GET("/genres", cache.Cache(store, IndexCacheTime, IndexStaleTime), TVGenres)
 	}
 	show := r.Group("/show")
 	{
-		show.GET("/:showId/seasons", cache.Cache(store, DefaultCacheTime), ShowSeasons)
-		show.GET("/:showId/season/:season/episodes", cache.Cache(store, EpisodesCacheTime), ShowEpisodes)
+		show.GET("/:showId/seasons", cache.Cache(store, DefaultCacheTime, ListingsStaleTime), ShowSeasons)
+		show.GET("/:showId/season/:season/episodes", cache.Cache(store, EpisodesCacheTime, EpisodesStaleTime), ShowEpisodes)
+		show.GET("/:showId/season/:season/packs", ShowSeasonPacks)
 		show.GET("/:showId/season/:season/episode/:episode/links", ShowEpisodeLinks)
 		show.GET("/:showId/season/:season/episode/:episode/play", ShowEpisodePlay)
 	}
@@ -75,6 +88,14 @@ func Routes(btService *bittorrent.BTService) *gin.Engine {
 	{
 		provider.GET("/:provider/movie/:imdbId", ProviderGetMovie)
 		provider.GET("/:provider/show/:showId/season/:season/episode/:episode", ProviderGetEpisode)
+		provider.GET("/:provider/manage", ProviderManage)
+		provider.GET("/:provider/conformance", ProviderConformance)
+	}
+
+	providersGroup := r.Group("/providers")
+	{
+		providersGroup.GET("/", ProvidersList)
+		providersGroup.GET("/stats", ProvidersStats)
 	}
 
 	repo := r.Group("/repository")
@@ -83,6 +104,8 @@ func Routes(btService *bittorrent.BTService) *gin.Engine {
 		repo.HEAD("/:user/:repository/*filepath", repository.GetAddonFiles)
 	}
 
+	r.GET("/trackers", TrackersHealth)
+
 	r.GET("/youtube/:id", PlayYoutubeVideo)
 
 	r.GET("/subtitles", SubtitlesIndex)
@@ -93,7 +116,8 @@ func Routes(btService *bittorrent.BTService) *gin.Engine {
 
 	cmd := r.Group("/cmd")
 	{
-		cmd.GET("/clear_cache", ClearCache)
+		cmd.GET("/clear_cache", ClearCache(store))
+		cmd.GET("/cache_stats", CacheStats)
 	}
 
 	return r
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log"
 	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/op/go-logging"
@@ -99,6 +100,9 @@ func ShowSeasons(ctx *gin.Context) {
 	for i := len(items) - 1; i >= 0; i-- {
 		item := items[i]
 		item.Path = UrlForXBMC("/show/%d/season/%d/episodes", show.Id, item.Info.Season)
+		item.ContextMenu = [][]string{
+			[]string{"Find season packs...", fmt.Sprintf("XBMC.PlayMedia(%s)", UrlForXBMC("/show/%d/season/%d/packs", show.Id, item.Info.Season))},
+		}
 		reversedItems = append(reversedItems, item)
 	}
 	// xbmc.ListItems always returns false to Less() so that order is unchanged
@@ -136,12 +140,12 @@ func ShowEpisodes(ctx *gin.Context) {
 	ctx.JSON(200, xbmc.NewView("episodes", items))
 }
 
-func showEpisodeLinks(showId string, seasonNumber, episodeNumber int) ([]*bittorrent.Torrent, error) {
+func episodeSearchers(showId string, seasonNumber, episodeNumber int) (*tvdb.Show, *tvdb.Episode, []providers.EpisodeSearcher, error) {
 	log.Println("Searching links for TVDB Id:", showId)
 
 	show, err := tvdb.NewShowCached(showId, config.Get().Language)
 	if err != nil {
-		return nil, err
+		return nil, nil, nil, err
 	}
 
 	episode := show.Seasons[seasonNumber].Episodes[episodeNumber-1]
@@ -153,13 +157,21 @@ func showEpisodeLinks(showId string, seasonNumber, episodeNumber int) ([]*bittor
 		xbmc.Notify("Pulsar", "Unable to find any providers", config.AddonIcon())
 	}
 
-	return providers.SearchEpisode(searchers, show, episode), nil
+	return show, episode, searchers, nil
+}
+
+func showEpisodeLinks(showId string, seasonNumber, episodeNumber int) (*tvdb.Show, []*bittorrent.Torrent, error) {
+	show, episode, searchers, err := episodeSearchers(showId, seasonNumber, episodeNumber)
+	if err != nil {
+		return nil, nil, err
+	}
+	return show, providers.SearchEpisode(searchers, show, episode), nil
 }
 
 func ShowEpisodeLinks(ctx *gin.Context) {
 	seasonNumber, _ := strconv.Atoi(ctx.Params.ByName("season"))
 	episodeNumber, _ := strconv.Atoi(ctx.Params.ByName("episode"))
-	torrents, err := showEpisodeLinks(ctx.Params.ByName("showId"), seasonNumber, episodeNumber)
+	_, torrents, err := showEpisodeLinks(ctx.Params.ByName("showId"), seasonNumber, episodeNumber)
 	if err != nil {
 		ctx.Error(err)
 		return
@@ -169,6 +181,7 @@ func ShowEpisodeLinks(ctx *gin.Context) {
 		xbmc.Notify("Pulsar", "No links were found", config.AddonIcon())
 		return
 	}
+	providers.GetQualityProfile().Sort(torrents)
 
 	choices := make([]string, 0, len(torrents))
 	for _, torrent := range torrents {
@@ -177,6 +190,14 @@ func ShowEpisodeLinks(ctx *gin.Context) {
 			torrent.Peers,
 			torrent.Name,
 		)
+		if info := append(sizeInfo(torrent), languageInfo(torrent)...); len(info) > 0 {
+			label = fmt.Sprintf("S:%d P:%d - %s - %s",
+				torrent.Seeds,
+				torrent.Peers,
+				strings.Join(info, " "),
+				torrent.Name,
+			)
+		}
 		choices = append(choices, label)
 	}
 
@@ -187,20 +208,73 @@ func ShowEpisodeLinks(ctx *gin.Context) {
 	}
 }
 
-func ShowEpisodePlay(ctx *gin.Context) {
+// ShowSeasonPacks lets the user choose a season pack, then the episode to
+// play from it.
+func ShowSeasonPacks(ctx *gin.Context) {
+	showId := ctx.Params.ByName("showId")
 	seasonNumber, _ := strconv.Atoi(ctx.Params.ByName("season"))
-	episodeNumber, _ := strconv.Atoi(ctx.Params.ByName("episode"))
-	torrents, err := showEpisodeLinks(ctx.Params.ByName("showId"), seasonNumber, episodeNumber)
+
+	log.Println("Searching season packs for TVDB Id:", showId)
+
+	show, err := tvdb.NewShowCached(showId, config.Get().Language)
 	if err != nil {
 		ctx.Error(err)
 		return
 	}
+	season := show.Seasons[seasonNumber]
+
+	searchers := providers.GetSeasonSearchers()
+	if len(searchers) == 0 {
+		xbmc.Notify("Pulsar", "No providers can search for season packs", config.AddonIcon())
+		return
+	}
 
+	torrents := providers.SearchSeason(searchers, show, season)
 	if len(torrents) == 0 {
-		xbmc.Notify("Pulsar", "No links were found", config.AddonIcon())
+		xbmc.Notify("Pulsar", "No season packs were found", config.AddonIcon())
+		return
+	}
+
+	choices := make([]string, 0, len(torrents))
+	for _, torrent := range torrents {
+		info := append(sizeInfo(torrent), languageInfo(torrent)...)
+		choices = append(choices, fmt.Sprintf("S:%d P:%d - %s - %s",
+			torrent.Seeds,
+			torrent.Peers,
+			strings.Join(info, " "),
+			torrent.Name,
+		))
+	}
+	choice := xbmc.ListDialog("Choose season pack", choices...)
+	if choice < 0 {
+		return
+	}
+	torrent := torrents[choice]
+
+	episodes := make([]string, 0, len(season.Episodes))
+	for _, episode := range season.Episodes {
+		episodes = append(episodes, fmt.Sprintf("%dx%02d %s", season.Season, episode.EpisodeNumber, episode.EpisodeName))
+	}
+	choice = xbmc.ListDialog("Choose episode", episodes...)
+	if choice < 0 {
 		return
 	}
 
-	rUrl := UrlQuery(UrlForXBMC("/play"), "uri", torrents[0].Magnet())
+	rUrl := UrlQuery(UrlForXBMC("/play"),
+		"uri", torrent.Magnet(),
+		"season", strconv.Itoa(season.Season),
+		"episode", strconv.Itoa(season.Episodes[choice].EpisodeNumber),
+	)
 	ctx.Redirect(302, rUrl)
 }
+
+func ShowEpisodePlay(ctx *gin.Context) {
+	seasonNumber, _ := strconv.Atoi(ctx.Params.ByName("season"))
+	episodeNumber, _ := strconv.Atoi(ctx.Params.ByName("episode"))
+	show, episode, searchers, err := episodeSearchers(ctx.Params.ByName("showId"), seasonNumber, episodeNumber)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	playFromStream(ctx, providers.StreamEpisode(searchers, show, episode), show.Runtime)
+}
@@ -0,0 +1,10 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/steeve/pulsar/providers"
+)
+
+func TrackersHealth(ctx *gin.Context) {
+	ctx.JSON(200, providers.GetTrackersHealth())
+}
@@ -0,0 +1,44 @@
+package api
+
+import (
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/steeve/pulsar/cache"
+	"github.com/steeve/pulsar/util"
+)
+
+// per page
+const warmUpTimeout = 2 * time.Minute
+
+// the lists users open first, and which are the slowest to build
+var warmUpPages = []string{
+	"/movies/popular",
+	"/movies/top",
+	"/shows/popular",
+	"/shows/top",
+}
+
+// WarmUpCache refreshes the cache of the main lists before users open them.
+// Pages are requested one at a time to go easy on TMDB, as cache refreshes so
+// that they aren't tracked as page views. The server must be listening.
+func WarmUpCache() {
+	client := &http.Client{Timeout: warmUpTimeout}
+	for _, page := range warmUpPages {
+		req, err := http.NewRequest("GET", util.GetHTTPHost()+page, nil)
+		if err != nil {
+			continue
+		}
+		req.Header.Set(cache.RefreshHeader, "1")
+		resp, err := client.Do(req)
+		if err != nil {
+			log.Printf("Unable to warm up %s: %s\n", page, err)
+			continue
+		}
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+	}
+}
@@ -0,0 +1,266 @@
+package bittorrent
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"sort"
+	"time"
+
+	"github.com/zeebo/bencode"
+)
+
+const (
+	dhtBootstrapPort  = 6881
+	dhtAlpha          = 8 // concurrent queries per lookup round
+	dhtMaxRounds      = 8
+	dhtRoundTimeout   = 1 * time.Second
+	dhtCompactNodeLen = 26
+	dhtCompactPeerLen = 6
+
+	// BEP 33 bloom filters are 2048 bits long, and use 2 hash functions.
+	bep33FilterSize = 256
+	bep33HashCount  = 2
+)
+
+// DHTScrapeResult is an estimation of a swarm size, as seen by the DHT.
+// When the nodes support BEP 33, Seeds and Peers are estimated from the
+// bloom filters they return. Otherwise seeds can't be told apart: Seeds is
+// left at 0, and Peers is the number of unique peers found during the lookup.
+type DHTScrapeResult struct {
+	Seeds      int64
+	Peers      int64
+	PeersFound int
+	BEP33      bool
+}
+
+type dhtNode struct {
+	id   string
+	addr *net.UDPAddr
+}
+
+type dhtResponse struct {
+	T string `bencode:"t"`
+	Y string `bencode:"y"`
+	R struct {
+		Id     string   `bencode:"id"`
+		Nodes  string   `bencode:"nodes"`
+		Values []string `bencode:"values"`
+		BFsd   string   `bencode:"BFsd"`
+		BFpe   string   `bencode:"BFpe"`
+	} `bencode:"r"`
+}
+
+type dhtLookup struct {
+	conn         net.PacketConn
+	nodeId       string
+	infoHash     string
+	transactions map[string]bool
+	queried      map[string]bool
+	candidates   []*dhtNode
+	peers        map[string]bool
+	seedsFilter  []byte
+	peersFilter  []byte
+	hasFilters   bool
+	transaction  uint16
+}
+
+// DHTScrape looks up infoHash on the DHT using get_peers queries with the
+// BEP 33 scrape flag, and estimates the swarm size from the answers.
+func DHTScrape(infoHash string, timeout time.Duration) (*DHTScrapeResult, error) {
+	bhash, err := hex.DecodeString(infoHash)
+	if err != nil || len(bhash) != 20 {
+		return nil, errors.New("Invalid info hash.")
+	}
+
+	conn, err := net.ListenPacket("udp4", ":0")
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	nodeId := make([]byte, 20)
+	rand.Read(nodeId)
+
+	lookup := &dhtLookup{
+		conn:         conn,
+		nodeId:       string(nodeId),
+		infoHash:     string(bhash),
+		transactions: make(map[string]bool),
+		queried:      make(map[string]bool),
+		candidates:   make([]*dhtNode, 0),
+		peers:        make(map[string]bool),
+		seedsFilter:  make([]byte, bep33FilterSize),
+		peersFilter:  make([]byte, bep33FilterSize),
+	}
+	for _, host := range dhtBootstrapNodes {
+		addr, err := net.ResolveUDPAddr("udp4", fmt.Sprintf("%s:%d", host, dhtBootstrapPort))
+		if err != nil {
+			continue
+		}
+		lookup.candidates = append(lookup.candidates, &dhtNode{addr: addr})
+	}
+	if len(lookup.candidates) == 0 {
+		return nil, errors.New("Unable to resolve DHT bootstrap nodes.")
+	}
+
+	deadline := time.Now().Add(timeout)
+	for round := 0; round < dhtMaxRounds && time.Now().Before(deadline); round++ {
+		if lookup.queryClosest() == 0 {
+			break
+		}
+		roundDeadline := time.Now().Add(dhtRoundTimeout)
+		if roundDeadline.After(deadline) {
+			roundDeadline = deadline
+		}
+		lookup.readResponses(roundDeadline)
+	}
+
+	result := &DHTScrapeResult{
+		PeersFound: len(lookup.peers),
+		Peers:      int64(len(lookup.peers)),
+		BEP33:      lookup.hasFilters,
+	}
+	if lookup.hasFilters {
+		result.Seeds = bloomFilterEstimate(lookup.seedsFilter)
+		result.Peers = bloomFilterEstimate(lookup.peersFilter)
+	}
+	return result, nil
+}
+
+// queryClosest sends get_peers to the dhtAlpha closest nodes not yet queried
+// and returns the number of queries sent.
+func (l *dhtLookup) queryClosest() int {
+	sort.Sort(byDistance{l.candidates, l.infoHash})
+	sent := 0
+	for _, node := range l.candidates {
+		if sent >= dhtAlpha {
+			break
+		}
+		if l.queried[node.addr.String()] {
+			continue
+		}
+		l.queried[node.addr.String()] = true
+		if err := l.sendGetPeers(node); err == nil {
+			sent++
+		}
+	}
+	return sent
+}
+
+func (l *dhtLookup) sendGetPeers(node *dhtNode) error {
+	l.transaction++
+	tid := make([]byte, 2)
+	binary.BigEndian.PutUint16(tid, l.transaction)
+	l.transactions[string(tid)] = true
+
+	query := map[string]interface{}{
+		"t": string(tid),
+		"y": "q",
+		"q": "get_peers",
+		"a": map[string]interface{}{
+			"id":        l.nodeId,
+			"info_hash": l.infoHash,
+			"scrape":    1,
+		},
+	}
+	packet := bytes.NewBuffer(nil)
+	if err := bencode.NewEncoder(packet).Encode(query); err != nil {
+		return err
+	}
+	_, err := l.conn.WriteTo(packet.Bytes(), node.addr)
+	return err
+}
+
+func (l *dhtLookup) readResponses(deadline time.Time) {
+	buffer := make([]byte, DefaultBufferSize)
+	l.conn.SetReadDeadline(deadline)
+	for {
+		n, _, err := l.conn.ReadFrom(buffer)
+		if err != nil {
+			return
+		}
+		response := dhtResponse{}
+		if err := bencode.NewDecoder(bytes.NewReader(buffer[:n])).Decode(&response); err != nil {
+			continue
+		}
+		if response.Y != "r" || l.transactions[response.T] == false {
+			continue
+		}
+		delete(l.transactions, response.T)
+		l.handleResponse(&response)
+	}
+}
+
+func (l *dhtLookup) handleResponse(response *dhtResponse) {
+	for _, value := range response.R.Values {
+		if len(value) == dhtCompactPeerLen {
+			l.peers[value] = true
+		}
+	}
+	if len(response.R.BFsd) == bep33FilterSize && len(response.R.BFpe) == bep33FilterSize {
+		l.hasFilters = true
+		for i := 0; i < bep33FilterSize; i++ {
+			l.seedsFilter[i] |= response.R.BFsd[i]
+			l.peersFilter[i] |= response.R.BFpe[i]
+		}
+	}
+	nodes := response.R.Nodes
+	for i := 0; i+dhtCompactNodeLen <= len(nodes); i += dhtCompactNodeLen {
+		compact := nodes[i : i+dhtCompactNodeLen]
+		addr := &net.UDPAddr{
+			IP:   net.IP([]byte(compact[20:24])),
+			Port: int(binary.BigEndian.Uint16([]byte(compact[24:26]))),
+		}
+		if addr.Port == 0 || l.queried[addr.String()] {
+			continue
+		}
+		l.candidates = append(l.candidates, &dhtNode{id: compact[:20], addr: addr})
+	}
+}
+
+// bloomFilterEstimate returns the number of items in a BEP 33 bloom filter.
+func bloomFilterEstimate(filter []byte) int64 {
+	m := float64(len(filter) * 8)
+	zeros := 0
+	for _, b := range filter {
+		for i := uint(0); i < 8; i++ {
+			if b&(1<<i) == 0 {
+				zeros++
+			}
+		}
+	}
+	// the filter is saturated, that's as far as it can count
+	if zeros == 0 {
+		zeros = 1
+	}
+	return int64(math.Log(float64(zeros)/m) / (bep33HashCount * math.Log(1-1/m)))
+}
+
+// byDistance sorts nodes by XOR distance to target, nodes with unknown ids
+// (bootstrap nodes) last.
+type byDistance struct {
+	nodes  []*dhtNode
+	target string
+}
+
+func (a byDistance) Len() int      { return len(a.nodes) }
+func (a byDistance) Swap(i, j int) { a.nodes[i], a.nodes[j] = a.nodes[j], a.nodes[i] }
+func (a byDistance) Less(i, j int) bool {
+	idI, idJ := a.nodes[i].id, a.nodes[j].id
+	if len(idI) != len(a.target) || len(idJ) != len(a.target) {
+		return len(idI) == len(a.target)
+	}
+	for k := 0; k < len(a.target); k++ {
+		dI, dJ := idI[k]^a.target[k], idJ[k]^a.target[k]
+		if dI != dJ {
+			return dI < dJ
+		}
+	}
+	return false
+}
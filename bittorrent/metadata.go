@@ -0,0 +1,136 @@
+package bittorrent
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/steeve/libtorrent-go"
+)
+
+var ErrMetadataTimeout = errors.New("metadata not received in time")
+
+// TorrentFiles returns the files of torrent. Magnets metadata is fetched from
+// their peers by the session, waiting at most timeout. The torrent is added in
+// upload mode so that it downloads nothing, and removed once resolved unless
+// the user added it in the meantime.
+func (s *BTService) TorrentFiles(torrent *Torrent, timeout time.Duration) ([]*TorrentFileInfo, error) {
+	if torrent.IsMagnet() == false {
+		return torrent.Files()
+	}
+	infoHash := strings.ToLower(torrent.InfoHash)
+
+	alerts, alertsDone := s.Alerts()
+	defer close(alertsDone)
+
+	torrentHandle, err := s.addResolvingTorrent(torrent.Magnet(), infoHash)
+	if err != nil {
+		return nil, err
+	}
+	defer s.removeResolvingTorrent(torrentHandle, infoHash)
+
+	if torrentHandle.Status(uint(0)).GetHas_metadata() == false {
+		deadline := time.After(timeout)
+	wait:
+		for {
+			select {
+			case alert, ok := <-alerts:
+				if !ok {
+					return nil, ErrMetadataTimeout
+				}
+				if alert.Xtype() != libtorrent.Metadata_received_alertAlert_type {
+					continue
+				}
+				metadataAlert := libtorrent.SwigcptrMetadata_received_alert(alert.Swigcptr())
+				if metadataAlert.GetHandle().Equal(torrentHandle) {
+					break wait
+				}
+			case <-deadline:
+				return nil, ErrMetadataTimeout
+			}
+		}
+	}
+
+	torrentInfo := torrentHandle.Torrent_file()
+	defer libtorrent.DeleteTorrent_info(torrentInfo)
+	numFiles := torrentInfo.Num_files()
+	files := make([]*TorrentFileInfo, 0, numFiles)
+	for i := 0; i < numFiles; i++ {
+		fe := torrentInfo.File_at(i)
+		files = append(files, &TorrentFileInfo{Path: fe.GetPath(), Length: fe.GetSize()})
+	}
+	return files, nil
+}
+
+// addResolvingTorrent adds a magnet whose metadata is wanted, in upload mode.
+// It fails if the torrent is already in the session, as it's the user's.
+func (s *BTService) addResolvingTorrent(magnet string, infoHash string) (libtorrent.Torrent_handle, error) {
+	s.torrentsLock.Lock()
+	defer s.torrentsLock.Unlock()
+
+	if s.hasTorrent(infoHash) {
+		return nil, fmt.Errorf("%s is already in the session", infoHash)
+	}
+
+	torrentParams := libtorrent.NewAdd_torrent_params()
+	defer libtorrent.DeleteAdd_torrent_params(torrentParams)
+	torrentParams.SetUrl(magnet)
+	torrentParams.SetSave_path(s.config.DownloadPath)
+	torrentParams.SetFlags(torrentParams.GetFlags() | uint64(libtorrent.Add_torrent_paramsFlag_upload_mode))
+
+	torrentHandle := s.Session.Add_torrent(torrentParams)
+	if torrentHandle == nil {
+		return nil, fmt.Errorf("unable to add torrent with uri %s", magnet)
+	}
+	s.resolving[infoHash] = true
+	return torrentHandle, nil
+}
+
+// removeResolvingTorrent removes a torrent added by addResolvingTorrent,
+// unless the user took it over. Its files are never deleted: in upload mode
+// it wrote none, and once taken over they are the user's.
+func (s *BTService) removeResolvingTorrent(torrentHandle libtorrent.Torrent_handle, infoHash string) {
+	s.torrentsLock.Lock()
+	defer s.torrentsLock.Unlock()
+
+	if s.resolving[infoHash] {
+		s.Session.Remove_torrent(torrentHandle, 0)
+	}
+	delete(s.resolving, infoHash)
+}
+
+// addTorrent adds a torrent for the user. If its metadata is being resolved,
+// the session returns the resolving handle, which the user then takes over.
+func (s *BTService) addTorrent(torrentParams libtorrent.Add_torrent_params, uri string) libtorrent.Torrent_handle {
+	s.torrentsLock.Lock()
+	defer s.torrentsLock.Unlock()
+
+	torrentHandle := s.Session.Add_torrent(torrentParams)
+	if torrentHandle == nil {
+		return nil
+	}
+	if infoHash := NewTorrent(uri).InfoHash; infoHash != "" && s.resolving[infoHash] {
+		s.resolving[infoHash] = false
+		torrentHandle.Set_upload_mode(false)
+	}
+	return torrentHandle
+}
+
+// must be called with torrentsLock held
+func (s *BTService) hasTorrent(infoHash string) bool {
+	// NB: this does NOT return a pointer to vector, no need to free!
+	torrentsVector := s.Session.Get_torrents()
+	torrentsVectorSize := int(torrentsVector.Size())
+	for i := 0; i < torrentsVectorSize; i++ {
+		torrentHandle := torrentsVector.Get(i)
+		if torrentHandle.Is_valid() == false {
+			continue
+		}
+		if hex.EncodeToString([]byte(torrentHandle.Info_hash().To_string())) == infoHash {
+			return true
+		}
+	}
+	return false
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"math"
 	"os"
+	"path/filepath"
 	"strings"
 	"sync"
 	"time"
@@ -53,6 +54,8 @@ type BTPlayer struct {
 	diskStatus               *diskusage.DiskStatus
 	closing                  chan interface{}
 	bufferEvents             *broadcast.Broadcaster
+	season                   int
+	episode                  int
 }
 
 func NewBTPlayer(bts *BTService, uri string, deleteAfter bool) *BTPlayer {
@@ -68,6 +71,13 @@ func NewBTPlayer(bts *BTService, uri string, deleteAfter bool) *BTPlayer {
 	return btp
 }
 
+// SelectEpisode makes the player play the file of an episode instead of the
+// biggest one, for season packs.
+func (btp *BTPlayer) SelectEpisode(season int, episode int) {
+	btp.season = season
+	btp.episode = episode
+}
+
 func (btp *BTPlayer) addTorrent() error {
 	btp.log.Info("Adding torrent")
 
@@ -85,7 +95,7 @@ func (btp *BTPlayer) addTorrent() error {
 	btp.log.Info("Setting save path to %s\n", btp.bts.config.DownloadPath)
 	torrentParams.SetSave_path(btp.bts.config.DownloadPath)
 
-	btp.torrentHandle = btp.bts.Session.Add_torrent(torrentParams)
+	btp.torrentHandle = btp.bts.addTorrent(torrentParams, btp.uri)
 	go btp.consumeAlerts()
 
 	status := btp.torrentHandle.Status(uint(libtorrent.Torrent_handleQuery_name))
@@ -154,6 +164,13 @@ func (btp *BTPlayer) onMetadataReceived() {
 	}
 
 	btp.biggestFile = btp.findBiggestFile()
+	if btp.episode > 0 {
+		if episodeFile, found := btp.findEpisodeFile(); found {
+			btp.biggestFile = episodeFile
+		} else {
+			btp.log.Info("Unable to find S%02dE%02d, falling back to the biggest file", btp.season, btp.episode)
+		}
+	}
 	btp.log.Info("Biggest file: %s", btp.biggestFile.GetPath())
 
 	btp.log.Info("Setting piece priorities")
@@ -248,6 +265,26 @@ func (btp *BTPlayer) findBiggestFile() libtorrent.File_entry {
 	return biggestFile
 }
 
+// findEpisodeFile returns the biggest file whose name matches the selected
+// episode.
+func (btp *BTPlayer) findEpisodeFile() (libtorrent.File_entry, bool) {
+	var episodeFile libtorrent.File_entry
+	found := false
+	maxSize := int64(0)
+	numFiles := btp.torrentInfo.Num_files()
+
+	for i := 0; i < numFiles; i++ {
+		fe := btp.torrentInfo.File_at(i)
+		info := ParseReleaseName(filepath.Base(fe.GetPath()))
+		if info.HasEpisode(btp.season, btp.episode) && fe.GetSize() > maxSize {
+			maxSize = fe.GetSize()
+			episodeFile = fe
+			found = true
+		}
+	}
+	return episodeFile, found
+}
+
 func (btp *BTPlayer) onStateChanged(stateAlert libtorrent.State_changed_alert) {
 	switch stateAlert.GetState() {
 	case libtorrent.Torrent_statusFinished:
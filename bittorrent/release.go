@@ -0,0 +1,457 @@
+package bittorrent
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	HDRNone = iota
+	HDR10
+	HDR10Plus
+	HDRDolbyVision
+)
+
+var (
+	HDRs = []string{"", "HDR10", "HDR10+", "Dolby Vision"}
+)
+
+// ReleaseInfo is what can be learned from a scene-style release name.
+type ReleaseInfo struct {
+	Title            string   `json:"title"`
+	Year             int      `json:"year,omitempty"`
+	Seasons          []int    `json:"seasons,omitempty"`
+	Episodes         []int    `json:"episodes,omitempty"`
+	AbsoluteEpisodes []int    `json:"absolute_episodes,omitempty"` // anime numbering, from the first episode of the series
+	Batch            bool     `json:"batch,omitempty"`
+	Complete         bool     `json:"complete,omitempty"`
+	Resolution       int      `json:"resolution"`
+	RipType          int      `json:"rip_type"`
+	VideoCodec       int      `json:"video_codec"`
+	AudioCodec       int      `json:"audio_codec"`
+	BitDepth         int      `json:"bit_depth,omitempty"`
+	HDR              int      `json:"hdr,omitempty"`
+	Atmos            bool     `json:"atmos,omitempty"`
+	Languages        []string `json:"languages,omitempty"`
+	Subtitles        []string `json:"subtitles,omitempty"`
+	Dubbed           bool     `json:"dubbed,omitempty"`
+	Hardcoded        bool     `json:"hardcoded,omitempty"` // burned-in subtitles
+	Group            string   `json:"group,omitempty"`
+	Repack           bool     `json:"repack,omitempty"`
+	Proper           bool     `json:"proper,omitempty"`
+	SceneRating      int      `json:"scene_rating"`
+}
+
+type releaseTag struct {
+	re    *regexp.Regexp
+	value int
+}
+
+// tag matches pattern as a whole token, that is surrounded by separators or
+// the ends of the name.
+func tag(pattern string) *regexp.Regexp {
+	return regexp.MustCompile(`(?i)(?:^|[^a-z0-9])(?:` + pattern + `)(?:$|[^a-z0-9])`)
+}
+
+// Tags are tried in order, the first one matching wins. Most specific tags
+// must come first.
+var (
+	releaseResolutionTags = []releaseTag{
+		{tag(`2160p|4k|uhd`), Resolution4k2k},
+		{tag(`1440p`), Resolution1440p},
+		{tag(`1080[pi]`), Resolution1080p},
+		{tag(`720p`), Resolution720p},
+		{tag(`480p|576p`), Resolution480p},
+		// no explicit resolution, guess from the source
+		{tag(`hdrip`), Resolution720p},
+		{tag(`xvid|divx|dvd\w*`), Resolution480p},
+	}
+	releaseRipTags = []releaseTag{
+		{tag(`cam|camrip|hdcam`), RipCam},
+		{tag(`ts|hdts|telesync`), RipTS},
+		{tag(`tc|telecine`), RipTC},
+		{tag(`dvd\W?scr`), RipDVDScr},
+		{tag(`scr|screener`), RipScr},
+		{tag(`(bd|blu\W?ray\W?)?remux`), RipRemux},
+		{tag(`blu\W?ray|b[dr]rip|bd(25|50)`), RipBluRay},
+		{tag(`web\W?dl|web\W?rip|web`), RipWeb},
+		{tag(`hd\W?tv|pdtv|hdrip`), RipHDTV},
+		{tag(`dvd\W?rip|dvd\W?r|dvd\W?(5|9)|dvd`), RipDVD},
+	}
+	releaseVideoTags = []releaseTag{
+		{tag(`[hx]\W?265|hevc`), CodecH265},
+		{tag(`av1`), CodecAV1},
+		{tag(`[hx]\W?264|avc`), CodecH264},
+		{tag(`xvid|divx`), CodecXVid},
+		// no explicit codec, guess from the source
+		{tag(`1080p|hdrip`), CodecH264},
+	}
+	releaseAudioTags = []releaseTag{
+		{tag(`dts\W?hd\W?ma`), CodecDTSHDMA},
+		{tag(`true\W?hd`), CodecTrueHD},
+		{tag(`dts\W?(hd|x)`), CodecDTSHD},
+		{tag(`dts`), CodecDTS},
+		{tag(`e\W?ac\W?3|ddp(\W?[257]\W?[01])?|dd\+`), CodecEAC3},
+		{tag(`ac3|dd\W?[257]\W?[01]|[257]\W[01]`), CodecAC3},
+		{tag(`flac`), CodecFLAC},
+		{tag(`aac(\W?[257]\W?[01])?`), CodecAAC},
+		{tag(`mp3`), CodecMp3},
+	}
+	releaseHDRTags = []releaseTag{
+		{tag(`dv|dovi|dolby\W?vision`), HDRDolbyVision},
+		{tag(`hdr10(\+|plus)`), HDR10Plus},
+		{tag(`hdr10|hdr`), HDR10},
+	}
+	releaseBitDepthTags = []releaseTag{
+		{tag(`10\W?bits?|hi10p?`), 10},
+		{tag(`8\W?bits?`), 8},
+	}
+	releaseSceneTags = []releaseTag{
+		{tag(`nuked`), RatingNuked},
+		{tag(`proper|repack|rerip`), RatingProper},
+	}
+
+	releaseLanguageTags = []struct {
+		re       *regexp.Regexp
+		language string
+	}{
+		{tag(`multi(\W?(lang|audio|subs?))?`), LanguageMulti},
+		{tag(`english|eng`), "en"},
+		{tag(`french|truefrench|vff|vfq|vf2?|fre`), "fr"},
+		{tag(`german|deutsch|ger`), "de"},
+		{tag(`spanish|espanol|castellano|esp|spa`), "es"},
+		{tag(`latino`), "es"},
+		{tag(`italian|ita`), "it"},
+		{tag(`portuguese|dublado|por`), "pt"},
+		{tag(`russian|rus`), "ru"},
+		{tag(`dutch|nl`), "nl"},
+		{tag(`swedish|swe`), "sv"},
+		{tag(`polish|pl`), "pl"},
+		{tag(`turkish|tur`), "tr"},
+		{tag(`japanese|jap|jpn`), "ja"},
+		{tag(`korean|kor`), "ko"},
+		{tag(`chinese|chi`), "zh"},
+		{tag(`hindi|hin`), "hi"},
+	}
+
+	// Subtitles tags are matched, and removed, before the language ones so
+	// that VOSTFR or ENG SUBS aren't taken for audio languages.
+	releaseSubtitleTags = []struct {
+		re       *regexp.Regexp
+		language string
+	}{
+		{tag(`vost\W?fr|vost|sub\W?french|fr\W?subs?`), "fr"},
+		{tag(`(eng?|english)\W?(subs?|subbed|subtitles)|subbed`), "en"},
+		{tag(`nl\W?subs?|dutch\W?subs?`), "nl"},
+		{tag(`swe?\W?subs?`), "sv"},
+		{tag(`ger\W?subs?|german\W?subs?`), "de"},
+		{tag(`ita\W?subs?|sub\W?ita`), "it"},
+		{tag(`spa\W?subs?|esp\W?subs?`), "es"},
+		{tag(`kor\W?subs?|korsub`), "ko"},
+		{tag(`chi\W?subs?|chs|cht`), "zh"},
+	}
+
+	releaseHardcodedTag = tag(`hc|hard\W?subs?|hard\W?subbed|hard\W?coded(\W?subs?)?|korsub`)
+	releaseDubbedTag    = tag(`dub|dubbed|dublado|vff|vfq`)
+	releaseAtmosTag     = tag(`atmos`)
+	releaseRepackTag    = tag(`repack|rerip`)
+	releaseProperTag    = tag(`proper|real`)
+
+	releaseEpisodePatterns = []*regexp.Regexp{
+		// S01E01, S01E01E02, S01E01-E03, S01E01-03
+		regexp.MustCompile(`(?i)(?:^|[^a-z0-9])s(\d{1,2})\W?e(\d{1,3})(?:\W?e(\d{1,3})|-(\d{1,3}))*(?:$|[^a-z0-9])`),
+		// 1x01, 1x01-1x02
+		regexp.MustCompile(`(?i)(?:^|[^a-z0-9])(\d{1,2})x(\d{2,3})(?:-(?:\d{1,2}x)?(\d{2,3}))?(?:$|[^a-z0-9])`),
+	}
+	// S01-S03, Season 1-3, Seasons 1 to 3, S01
+	releaseSeasonPattern = regexp.MustCompile(`(?i)(?:^|[^a-z0-9])(?:s|seasons?\W?)(\d{1,2})(?:\W?(?:-|to)\W?(?:s|season\W?)?(\d{1,2}))?(?:$|[^a-z0-9])`)
+	// Anime: Show - 01, Show - 01v2, Show Episode 01, Show #01
+	releaseAbsolutePattern = regexp.MustCompile(`(?i)(?:\s-\s|\s(?:episode|ep)\W?|\s#)(\d{1,4})(?:v\d)?(?:$|[\s\[(])`)
+	// Anime batches: Show - 01-12, Show (01~12), Show [01-12]
+	releaseBatchPattern    = regexp.MustCompile(`(?i)(?:\s-\s|[\[(])(\d{1,4})\s?(?:-|~|to)\s?(\d{1,4})(?:v\d)?(?:$|[\s\])])`)
+	releaseBatchTag        = tag(`batch`)
+	releaseCompletePattern = regexp.MustCompile(`(?i)(?:^|[^a-z0-9])(complete|full\W?series|integrale)(?:$|[^a-z0-9])`)
+	releaseYearPattern     = regexp.MustCompile(`(?:19|20)\d{2}`)
+
+	releaseResolutionTag = tag(`\d{3,4}[pi]|4k|uhd`)
+	releaseOnlyGroup     = regexp.MustCompile(`^-\s?[a-zA-Z0-9]+\s*$`)
+
+	releaseLeadingGroup   = regexp.MustCompile(`^\s*\[([^\]]+)\]`)
+	releaseTrailingGroup  = regexp.MustCompile(`-\s?([a-zA-Z0-9]+)\s*$`)
+	releaseNotAGroup      = regexp.MustCompile(`(?i)^(dl|rip|hd|sd|x?264|x?265|\d+)$`)
+	releaseExtension      = regexp.MustCompile(`(?i)\.(mkv|mp4|avi|m4v|wmv|ts|torrent)$`)
+	releaseTrailingTags   = regexp.MustCompile(`(\s*\[[^\]]*\])+\s*$`)
+	releaseTitleSeparator = regexp.MustCompile(`[._\s]+`)
+)
+
+const (
+	LanguageMulti = "multi"
+)
+
+// ParseReleaseName extracts everything it can from a release name. It is
+// deterministic: when several tags of the same kind are present, the most
+// specific one wins.
+func ParseReleaseName(name string) *ReleaseInfo {
+	info := &ReleaseInfo{}
+
+	name = strings.TrimSpace(name)
+	name = releaseExtension.ReplaceAllString(name, "")
+
+	titleStart := 0
+	if match := releaseLeadingGroup.FindStringSubmatchIndex(name); match != nil {
+		info.Group = strings.TrimSpace(name[match[2]:match[3]])
+		titleStart = match[1]
+	}
+
+	// Episode numbers and years are looked for first, and the title stops at
+	// them: quality tags before, like the Web of Charlottes.Web.2006, are
+	// part of the title. Only names without either end at a quality tag.
+	limit := len(name)
+	if idx := parseEpisodes(info, name[titleStart:]); idx >= 0 {
+		limit = titleStart + idx
+	}
+	if len(info.Episodes) == 0 && len(info.Seasons) == 0 {
+		if idx := parseAbsoluteEpisodes(info, name[titleStart:]); idx >= 0 {
+			limit = titleStart + idx
+		}
+	}
+	numbered := limit < len(name)
+	if numbered == false {
+		// years are before the resolution, what follows is the group
+		if loc := releaseResolutionTag.FindStringIndex(name[titleStart:]); loc != nil {
+			limit = titleStart + loc[0]
+		}
+	}
+	titleEnd := -1
+	// years can follow each other (2012.2009), so boundaries are checked by
+	// hand instead of being consumed by the regexp
+	for _, loc := range releaseYearPattern.FindAllStringIndex(name, -1) {
+		if loc[0] <= titleStart || loc[0] >= limit || !isReleaseSeparator(name, loc[0]-1) || !isReleaseSeparator(name, loc[1]) {
+			continue
+		}
+		info.Year, _ = strconv.Atoi(name[loc[0]:loc[1]])
+		titleEnd = loc[0]
+	}
+	if titleEnd < 0 {
+		titleEnd = limit
+		if numbered == false {
+			if idx := firstQualityTag(name, titleStart); idx >= 0 && idx < titleEnd {
+				titleEnd = idx
+			}
+		}
+	}
+
+	info.Title = cleanReleaseTitle(name[titleStart:titleEnd])
+
+	tail := name[titleEnd:]
+	info.Resolution = firstReleaseTag(tail, releaseResolutionTags)
+	info.RipType = firstReleaseTag(tail, releaseRipTags)
+	info.VideoCodec = firstReleaseTag(tail, releaseVideoTags)
+	info.AudioCodec = firstReleaseTag(tail, releaseAudioTags)
+	info.HDR = firstReleaseTag(tail, releaseHDRTags)
+	info.BitDepth = firstReleaseTag(tail, releaseBitDepthTags)
+	info.SceneRating = firstReleaseTag(tail, releaseSceneTags)
+	info.Atmos = releaseAtmosTag.MatchString(tail)
+	info.Repack = releaseRepackTag.MatchString(tail)
+	info.Proper = releaseProperTag.MatchString(tail)
+	info.Batch = info.Batch || releaseBatchTag.MatchString(tail)
+	info.Hardcoded = releaseHardcodedTag.MatchString(tail)
+	info.Dubbed = releaseDubbedTag.MatchString(tail)
+	languagesTail := tail
+	for _, st := range releaseSubtitleTags {
+		if st.re.MatchString(languagesTail) {
+			info.Subtitles = appendLanguage(info.Subtitles, st.language)
+			languagesTail = st.re.ReplaceAllString(languagesTail, " ")
+		}
+	}
+	for _, lt := range releaseLanguageTags {
+		if lt.re.MatchString(languagesTail) {
+			info.Languages = appendLanguage(info.Languages, lt.language)
+		}
+	}
+
+	if info.Group == "" {
+		stripped := releaseTrailingTags.ReplaceAllString(tail, "")
+		if match := releaseTrailingGroup.FindStringSubmatch(stripped); match != nil && releaseNotAGroup.MatchString(match[1]) == false {
+			info.Group = match[1]
+		}
+	}
+
+	return info
+}
+
+// parseAbsoluteEpisodes fills the absolute episodes of anime releases, and
+// returns the position of the numbering in name, or -1.
+func parseAbsoluteEpisodes(info *ReleaseInfo, name string) int {
+	if match := releaseBatchPattern.FindStringSubmatchIndex(name); match != nil {
+		first, _ := strconv.Atoi(name[match[2]:match[3]])
+		last, _ := strconv.Atoi(name[match[4]:match[5]])
+		if first < last && isYear(first) == false && isYear(last) == false {
+			info.AbsoluteEpisodes = intRange(first, last)
+			info.Batch = true
+			return match[0]
+		}
+	}
+	for _, match := range releaseAbsolutePattern.FindAllStringSubmatchIndex(name, -1) {
+		episode, _ := strconv.Atoi(name[match[2]:match[3]])
+		if episode == 0 || isYear(episode) {
+			continue
+		}
+		info.AbsoluteEpisodes = []int{episode}
+		return match[0]
+	}
+	return -1
+}
+
+func isYear(number int) bool {
+	return number >= 1900 && number < 2100
+}
+
+// HasAbsoluteEpisode returns true if the release contains the episode with
+// that absolute number.
+func (info *ReleaseInfo) HasAbsoluteEpisode(absolute int) bool {
+	for _, e := range info.AbsoluteEpisodes {
+		if e == absolute {
+			return true
+		}
+	}
+	return false
+}
+
+// HasEpisode returns true if the release contains episode of season. Names
+// without a season, like in season packs folders, match any season.
+func (info *ReleaseInfo) HasEpisode(season int, episode int) bool {
+	seasonFound := len(info.Seasons) == 0
+	for _, s := range info.Seasons {
+		if s == season {
+			seasonFound = true
+		}
+	}
+	if seasonFound == false {
+		return false
+	}
+	for _, e := range info.Episodes {
+		if e == episode {
+			return true
+		}
+	}
+	return false
+}
+
+// parseEpisodes fills seasons and episodes, and returns the position of the
+// first season/episode marker, or -1.
+func parseEpisodes(info *ReleaseInfo, name string) int {
+	for _, re := range releaseEpisodePatterns {
+		match := re.FindStringSubmatchIndex(name)
+		if match == nil {
+			continue
+		}
+		season, _ := strconv.Atoi(name[match[2]:match[3]])
+		first, _ := strconv.Atoi(name[match[4]:match[5]])
+		last := first
+		// the last episode of the range is in the last matching group
+		for g := len(match)/2 - 1; g > 2; g-- {
+			if match[2*g] >= 0 {
+				last, _ = strconv.Atoi(name[match[2*g]:match[2*g+1]])
+				break
+			}
+		}
+		info.Seasons = []int{season}
+		info.Episodes = intRange(first, last)
+		return match[0]
+	}
+
+	idx := -1
+	if match := releaseSeasonPattern.FindStringSubmatchIndex(name); match != nil {
+		first, _ := strconv.Atoi(name[match[2]:match[3]])
+		last := first
+		if match[4] >= 0 {
+			last, _ = strconv.Atoi(name[match[4]:match[5]])
+		}
+		info.Seasons = intRange(first, last)
+		idx = match[0]
+	}
+	if match := releaseCompletePattern.FindStringIndex(name); match != nil {
+		info.Complete = true
+		if idx < 0 || match[0] < idx {
+			idx = match[0]
+		}
+	}
+	return idx
+}
+
+// firstQualityTag returns the position of the first quality tag of name
+// after from, or -1. Tags are also common words, like Web or DV, so a tag only
+// counts when it's an explicit resolution, when it's next to another tag, or
+// when only the group follows it.
+func firstQualityTag(name string, from int) int {
+	locs := make([][]int, 0)
+	for _, tags := range [][]releaseTag{releaseResolutionTags, releaseRipTags, releaseVideoTags, releaseAudioTags, releaseHDRTags, releaseBitDepthTags} {
+		for _, t := range tags {
+			locs = append(locs, t.re.FindAllStringIndex(name, -1)...)
+		}
+	}
+	starts := make(map[int]bool)
+	for _, loc := range locs {
+		starts[loc[0]] = true
+	}
+
+	first := -1
+	for _, loc := range locs {
+		if loc[0] <= from || (first >= 0 && loc[0] >= first) {
+			continue
+		}
+		// tags match with their surrounding separators, so the next tag
+		// starts on the separator ending this one
+		confirmed := releaseResolutionTag.MatchString(name[loc[0]:loc[1]]) ||
+			starts[loc[1]-1] || starts[loc[1]] ||
+			releaseOnlyGroup.MatchString(name[loc[1]-1:])
+		if confirmed {
+			first = loc[0]
+		}
+	}
+	return first
+}
+
+func isReleaseSeparator(name string, i int) bool {
+	if i < 0 || i >= len(name) {
+		return true
+	}
+	c := name[i]
+	return !(c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z')
+}
+
+func firstReleaseTag(name string, tags []releaseTag) int {
+	for _, t := range tags {
+		if t.re.MatchString(name) {
+			return t.value
+		}
+	}
+	return 0
+}
+
+func cleanReleaseTitle(title string) string {
+	title = releaseTitleSeparator.ReplaceAllString(title, " ")
+	return strings.Trim(title, " -([{")
+}
+
+func appendLanguage(languages []string, language string) []string {
+	for _, l := range languages {
+		if l == language {
+			return languages
+		}
+	}
+	return append(languages, language)
+}
+
+func intRange(first, last int) []int {
+	if last < first {
+		last = first
+	}
+	r := make([]int, 0, last-first+1)
+	for i := first; i <= last; i++ {
+		r = append(r, i)
+	}
+	return r
+}
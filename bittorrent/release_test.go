@@ -0,0 +1,103 @@
+package bittorrent
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseReleaseName(t *testing.T) {
+	tests := []struct {
+		name string
+		want ReleaseInfo
+	}{
+		{
+			"The.Matrix.1999.1080p.BluRay.x264-SPARKS",
+			ReleaseInfo{Title: "The Matrix", Year: 1999, Resolution: Resolution1080p, RipType: RipBluRay, VideoCodec: CodecH264, Group: "SPARKS"},
+		},
+		// quality tags in titles
+		{
+			"Charlottes.Web.2006.1080p.BluRay.x264-GRP",
+			ReleaseInfo{Title: "Charlottes Web", Year: 2006, Resolution: Resolution1080p, RipType: RipBluRay, VideoCodec: CodecH264, Group: "GRP"},
+		},
+		{
+			"The.Web.2013.720p.HDTV.x264",
+			ReleaseInfo{Title: "The Web", Year: 2013, Resolution: Resolution720p, RipType: RipHDTV, VideoCodec: CodecH264},
+		},
+		{
+			"The.Dv.Files",
+			ReleaseInfo{Title: "The Dv Files"},
+		},
+		{
+			"The.Dv.Files.S01E02.720p.WEB-DL",
+			ReleaseInfo{Title: "The Dv Files", Seasons: []int{1}, Episodes: []int{2}, Resolution: Resolution720p, RipType: RipWeb},
+		},
+		{
+			"Cam.2018.1080p.NF.WEBRip.DDP5.1.x264-NTG",
+			ReleaseInfo{Title: "Cam", Year: 2018, Resolution: Resolution1080p, RipType: RipWeb, VideoCodec: CodecH264, AudioCodec: CodecEAC3, Group: "NTG"},
+		},
+		// years in titles
+		{
+			"Blade.Runner.2049.2017.2160p.UHD.BluRay.REMUX.HDR.HEVC.Atmos-EPSiLON",
+			ReleaseInfo{Title: "Blade Runner 2049", Year: 2017, Resolution: Resolution4k2k, RipType: RipRemux, VideoCodec: CodecH265, HDR: HDR10, Atmos: true, Group: "EPSiLON"},
+		},
+		{
+			"2012.2009.720p.BRRip.XviD.AC3-ViSiON",
+			ReleaseInfo{Title: "2012", Year: 2009, Resolution: Resolution720p, RipType: RipBluRay, VideoCodec: CodecXVid, AudioCodec: CodecAC3, Group: "ViSiON"},
+		},
+		{
+			"Movie Name (2019) [1080p] [YTS.MX]",
+			ReleaseInfo{Title: "Movie Name", Year: 2019, Resolution: Resolution1080p, VideoCodec: CodecH264},
+		},
+		// names without year nor episode
+		{
+			"Some.Show.HDTV.x264-LOL",
+			ReleaseInfo{Title: "Some Show", RipType: RipHDTV, VideoCodec: CodecH264, Group: "LOL"},
+		},
+		// episodes
+		{
+			"Doctor.Who.2005.S01E01.720p.HDTV.x264-GRP",
+			ReleaseInfo{Title: "Doctor Who", Year: 2005, Seasons: []int{1}, Episodes: []int{1}, Resolution: Resolution720p, RipType: RipHDTV, VideoCodec: CodecH264, Group: "GRP"},
+		},
+		{
+			"Game of Thrones S01E01-E03 1080p WEB-DL DDP5.1 H.264",
+			ReleaseInfo{Title: "Game of Thrones", Seasons: []int{1}, Episodes: []int{1, 2, 3}, Resolution: Resolution1080p, RipType: RipWeb, VideoCodec: CodecH264, AudioCodec: CodecEAC3},
+		},
+		{
+			"Friends.3x05.PROPER.DVDRip.XviD",
+			ReleaseInfo{Title: "Friends", Seasons: []int{3}, Episodes: []int{5}, Resolution: Resolution480p, RipType: RipDVD, VideoCodec: CodecXVid, Proper: true, SceneRating: RatingProper},
+		},
+		{
+			"Breaking Bad Season 1-5 Complete 1080p BluRay x265 10bit",
+			ReleaseInfo{Title: "Breaking Bad", Seasons: []int{1, 2, 3, 4, 5}, Complete: true, Resolution: Resolution1080p, RipType: RipBluRay, VideoCodec: CodecH265, BitDepth: 10},
+		},
+		// anime
+		{
+			"[HorribleSubs] One Piece - 1050 [1080p].mkv",
+			ReleaseInfo{Title: "One Piece", AbsoluteEpisodes: []int{1050}, Resolution: Resolution1080p, VideoCodec: CodecH264, Group: "HorribleSubs"},
+		},
+		{
+			"[Group] Boku no Hero Academia - 01 ~ 03 [1080p]",
+			ReleaseInfo{Title: "Boku no Hero Academia", AbsoluteEpisodes: []int{1, 2, 3}, Batch: true, Resolution: Resolution1080p, VideoCodec: CodecH264, Group: "Group"},
+		},
+		{
+			"[SubsPlease] Show Name 2019 - 03 (1080p)",
+			ReleaseInfo{Title: "Show Name", Year: 2019, AbsoluteEpisodes: []int{3}, Resolution: Resolution1080p, VideoCodec: CodecH264, Group: "SubsPlease"},
+		},
+		// languages and subtitles
+		{
+			"Dune.2021.MULTi.TRUEFRENCH.2160p.WEB-DL.DV.HDR10+.DDP5.1.Atmos.x265-GRP",
+			ReleaseInfo{Title: "Dune", Year: 2021, Resolution: Resolution4k2k, RipType: RipWeb, VideoCodec: CodecH265, AudioCodec: CodecEAC3, HDR: HDRDolbyVision, Atmos: true, Languages: []string{LanguageMulti, "fr"}, Group: "GRP"},
+		},
+		{
+			"Parasite.2019.KORSUB.HDRip.x264-STUTTERSHIT",
+			ReleaseInfo{Title: "Parasite", Year: 2019, Resolution: Resolution720p, RipType: RipHDTV, VideoCodec: CodecH264, Subtitles: []string{"ko"}, Hardcoded: true, Group: "STUTTERSHIT"},
+		},
+	}
+
+	for _, test := range tests {
+		got := ParseReleaseName(test.name)
+		if reflect.DeepEqual(*got, test.want) == false {
+			t.Errorf("ParseReleaseName(%q)\n got: %+v\nwant: %+v", test.name, *got, test.want)
+		}
+	}
+}
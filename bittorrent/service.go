@@ -1,10 +1,12 @@
 package bittorrent
 
 import (
+	"fmt"
 	"io"
 	"io/ioutil"
 	"net"
 	"runtime"
+	"sync"
 	"time"
 
 	"github.com/op/go-logging"
@@ -66,6 +68,11 @@ type BTService struct {
 	libtorrentLog     *logging.Logger
 	alertsBroadcaster *broadcast.Broadcaster
 	closing           chan interface{}
+
+	// guards adding torrents, and the hashes whose metadata is being
+	// resolved: true until the user adds them too
+	torrentsLock sync.Mutex
+	resolving    map[string]bool
 }
 
 func NewBTService(config BTConfiguration) *BTService {
@@ -76,6 +83,7 @@ func NewBTService(config BTConfiguration) *BTService {
 		alertsBroadcaster: broadcast.NewBroadcaster(),
 		config:            &config,
 		closing:           make(chan interface{}),
+		resolving:         make(map[string]bool),
 	}
 
 	s.configure()
@@ -212,6 +220,20 @@ func (s *BTService) configure() {
 	}
 }
 
+// AddTorrent starts downloading uri in the background, without playing it.
+func (s *BTService) AddTorrent(uri string) error {
+	torrentParams := libtorrent.NewAdd_torrent_params()
+	defer libtorrent.DeleteAdd_torrent_params(torrentParams)
+
+	torrentParams.SetUrl(uri)
+	torrentParams.SetSave_path(s.config.DownloadPath)
+
+	if torrentHandle := s.addTorrent(torrentParams, uri); torrentHandle == nil {
+		return fmt.Errorf("unable to add torrent with uri %s", uri)
+	}
+	return nil
+}
+
 func (s *BTService) Listen() {
 	errCode := libtorrent.NewError_code()
 	defer libtorrent.DeleteError_code(errCode)
@@ -7,9 +7,10 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
-	"regexp"
+	"path"
 	"strings"
 
 	"github.com/steeve/pulsar/xbmc"
@@ -26,6 +27,10 @@ type Torrent struct {
 	Peers     int64    `json:"peers"`
 	IsPrivate bool     `json:"is_private"`
 
+	// implied from Size and runtime, in bits per second
+	Bitrate     int64 `json:"bitrate,omitempty"`
+	IsOversized bool  `json:"is_oversized,omitempty"`
+
 	Resolution  int    `json:"resolution"`
 	VideoCodec  int    `json:"video_codec"`
 	AudioCodec  int    `json:"audio_codec"`
@@ -33,6 +38,8 @@ type Torrent struct {
 	RipType     int    `json:"rip_type"`
 	SceneRating int    `json:"scene_rating"`
 
+	Release *ReleaseInfo `json:"release,omitempty"`
+
 	hasResolved bool
 }
 
@@ -46,12 +53,7 @@ const (
 )
 
 var (
-	resolutionTags = map[*regexp.Regexp]int{
-		regexp.MustCompile(`\W+(480p|xvid|dvd)\W*`): Resolution480p,
-		regexp.MustCompile(`\W+(720p|hdrip)\W*`):    Resolution720p,
-		regexp.MustCompile(`\W+1080p\W*`):           Resolution1080p,
-	}
-	Resolutions = []string{"", "480p", "720p", "1080p"}
+	Resolutions = []string{"", "480p", "720p", "1080p", "1440p", "4K"}
 )
 
 const (
@@ -65,21 +67,11 @@ const (
 	RipHDTV
 	RipWeb
 	RipBluRay
+	RipRemux
 )
 
 var (
-	ripTags = map[*regexp.Regexp]int{
-		regexp.MustCompile(`\W+(cam|camrip|hdcam)\W*`):   RipCam,
-		regexp.MustCompile(`\W+(ts|telesync)\W*`):        RipTS,
-		regexp.MustCompile(`\W+(tc|telecine)\W*`):        RipTC,
-		regexp.MustCompile(`\W+(scr|screener)\W*`):       RipScr,
-		regexp.MustCompile(`\W+dvd\W*scr\W*`):            RipDVDScr,
-		regexp.MustCompile(`\W+dvd\W*rip\W*`):            RipDVD,
-		regexp.MustCompile(`\W+hd(tv|rip)\W*`):           RipHDTV,
-		regexp.MustCompile(`\W+(web\W*dl|web\W*rip)\W*`): RipWeb,
-		regexp.MustCompile(`\W+(bluray|b[rd]rip)\W*`):    RipBluRay,
-	}
-	Rips = []string{"", "Cam", "TeleSync", "TeleCine", "Screener", "DVD Screener", "DVDRip", "HDTV", "WebDL", "Blu-Ray"}
+	Rips = []string{"", "Cam", "TeleSync", "TeleCine", "Screener", "DVD Screener", "DVDRip", "HDTV", "WebDL", "Blu-Ray", "Remux"}
 )
 
 const (
@@ -88,13 +80,6 @@ const (
 	RatingNuked
 )
 
-var (
-	sceneTags = map[*regexp.Regexp]int{
-		regexp.MustCompile(`\W+nuked\W*`):  RatingNuked,
-		regexp.MustCompile(`\W+proper\W*`): RatingProper,
-	}
-)
-
 const (
 	CodecUnknown = iota
 
@@ -107,22 +92,17 @@ const (
 	CodecDTS
 	CodecDTSHD
 	CodecDTSHDMA
+
+	CodecH265
+	CodecAV1
+
+	CodecEAC3
+	CodecTrueHD
+	CodecFLAC
 )
 
 var (
-	videoTags = map[*regexp.Regexp]int{
-		regexp.MustCompile(`\W+([hx]264|1080p|hdrip)\W*`): CodecH264,
-		regexp.MustCompile(`\W+xvid\W*`):                  CodecXVid,
-	}
-	audioTags = map[*regexp.Regexp]int{
-		regexp.MustCompile(`\W+mp3\W*`):              CodecMp3,
-		regexp.MustCompile(`\W+aac\W*`):              CodecAAC,
-		regexp.MustCompile(`\W+(ac3|[Dd]*5\W+1)\W*`): CodecAC3,
-		regexp.MustCompile(`\W+dts\W*`):              CodecDTS,
-		regexp.MustCompile(`\W+dts\W+hd\W*`):         CodecDTSHD,
-		regexp.MustCompile(`\W+dts\W+hd\W+ma\W*`):    CodecDTSHDMA,
-	}
-	Codecs = []string{"", "Xvid", "h264", "MP3", "AAC", "AC3", "DTS", "DTS HD", "DTS HD MA"}
+	Codecs = []string{"", "Xvid", "h264", "MP3", "AAC", "AC3", "DTS", "DTS HD", "DTS HD MA", "hevc", "av1", "EAC3", "TrueHD", "FLAC"}
 )
 
 var (
@@ -137,6 +117,11 @@ const (
 	torCache = "http://torcache.net/torrent/%s.torrent"
 )
 
+type TorrentFileInfo struct {
+	Path   string `json:"path"`
+	Length int64  `json:"length"`
+}
+
 // Used to avoid infinite recursion in UnmarshalJSON
 type torrent Torrent
 
@@ -146,7 +131,7 @@ func (t *Torrent) UnmarshalJSON(b []byte) error {
 		return err
 	}
 	*t = Torrent(tmp)
-	t.initialize()
+	t.Initialize()
 	return nil
 }
 
@@ -193,24 +178,12 @@ func (t *Torrent) Resolve() error {
 		return nil
 	}
 
-	parts := strings.Split(t.URI, "|")
-	uri := parts[0]
-	req, err := http.NewRequest("GET", uri, nil)
+	body, err := fetchTorrentFile(t.URI)
 	if err != nil {
 		return err
 	}
-	if len(parts) > 1 {
-		for _, part := range parts[1:] {
-			keyVal := strings.SplitN(part, "=", 2)
-			req.Header.Add(keyVal[0], keyVal[1])
-		}
-	}
-
-	resp, err := httpClient.Do(req)
-	if err != nil {
-		return err
-	}
-	dec := bencode.NewDecoder(resp.Body)
+	defer body.Close()
+	dec := bencode.NewDecoder(body)
 
 	// FIXME!!!!
 	if err := dec.Decode(&torrentFile); err != nil {
@@ -233,52 +206,130 @@ func (t *Torrent) Resolve() error {
 
 	t.hasResolved = true
 
-	t.initialize()
+	t.Initialize()
 
 	return nil
 }
 
-func (t *Torrent) initialize() {
+// fetchTorrentFile downloads a .torrent file. Extra headers can be passed
+// after the URL, as in http://host/file.torrent|Cookie=value
+func fetchTorrentFile(uri string) (io.ReadCloser, error) {
+	parts := strings.Split(uri, "|")
+	req, err := http.NewRequest("GET", parts[0], nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(parts) > 1 {
+		for _, part := range parts[1:] {
+			keyVal := strings.SplitN(part, "=", 2)
+			req.Header.Add(keyVal[0], keyVal[1])
+		}
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("Unable to fetch %s: %s", parts[0], resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// Files fetches the torrent metadata and returns the files it contains.
+// Magnets metadata is looked up on torcache, see BTService.TorrentFiles to
+// get it from their peers instead.
+func (t *Torrent) Files() ([]*TorrentFileInfo, error) {
+	var torrentFile struct {
+		Info struct {
+			Name   string `bencode:"name"`
+			Length int64  `bencode:"length"`
+			Files  []struct {
+				Length int64    `bencode:"length"`
+				Path   []string `bencode:"path"`
+			} `bencode:"files"`
+		} `bencode:"info"`
+	}
+
+	uri := t.URI
+	if t.IsMagnet() {
+		uri = fmt.Sprintf(torCache, strings.ToUpper(t.InfoHash))
+	}
+	body, err := fetchTorrentFile(uri)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	if err := bencode.NewDecoder(body).Decode(&torrentFile); err != nil {
+		return nil, err
+	}
+
+	// single file torrent
+	if len(torrentFile.Info.Files) == 0 {
+		return []*TorrentFileInfo{
+			{Path: torrentFile.Info.Name, Length: torrentFile.Info.Length},
+		}, nil
+	}
+	files := make([]*TorrentFileInfo, 0, len(torrentFile.Info.Files))
+	for _, file := range torrentFile.Info.Files {
+		files = append(files, &TorrentFileInfo{
+			Path:   path.Join(append([]string{torrentFile.Info.Name}, file.Path...)...),
+			Length: file.Length,
+		})
+	}
+	return files, nil
+}
+
+// Initialize fills the torrent with what can be learned from its URI and
+// name. Native providers building torrents by hand must call it once URI and
+// Name are set.
+func (t *Torrent) Initialize() {
 	if strings.HasPrefix(t.URI, "magnet:") {
 		t.initializeFromMagnet()
 	}
 
+	t.Release = ParseReleaseName(t.Name)
 	if t.Resolution == ResolutionUnkown {
-		t.Resolution = matchTags(t, resolutionTags)
+		t.Resolution = t.Release.Resolution
 	}
 	if t.VideoCodec == CodecUnknown {
-		t.VideoCodec = matchTags(t, videoTags)
+		t.VideoCodec = t.Release.VideoCodec
 	}
 	if t.AudioCodec == CodecUnknown {
-		t.AudioCodec = matchTags(t, audioTags)
+		t.AudioCodec = t.Release.AudioCodec
 	}
 	if t.RipType == RipUnknown {
-		t.RipType = matchTags(t, ripTags)
+		t.RipType = t.Release.RipType
 	}
 	if t.SceneRating == RatingUnkown {
-		t.SceneRating = matchTags(t, sceneTags)
+		t.SceneRating = t.Release.SceneRating
 	}
 }
 
+// Languages returns the audio languages of the torrent, as told by the
+// provider and its name. Languages are ISO 639-1 codes, or LanguageMulti.
+func (t *Torrent) Languages() []string {
+	languages := make([]string, 0)
+	if t.Language != "" {
+		languages = append(languages, strings.ToLower(t.Language))
+	}
+	if t.Release != nil {
+		for _, language := range t.Release.Languages {
+			languages = appendLanguage(languages, language)
+		}
+	}
+	return languages
+}
+
 func NewTorrent(uri string) *Torrent {
 	t := &Torrent{
 		URI: uri,
 	}
-	t.initialize()
+	t.Initialize()
 	return t
 }
 
-func matchTags(t *Torrent, tokens map[*regexp.Regexp]int) int {
-	lowName := strings.ToLower(t.Name)
-	codec := 0
-	for re, value := range tokens {
-		if re.MatchString(lowName) {
-			codec = value
-		}
-	}
-	return codec
-}
-
 func (t *Torrent) IsMagnet() bool {
 	return strings.HasPrefix(t.URI, "magnet:")
 }
@@ -322,6 +373,14 @@ func (t *Torrent) StreamInfo() *xbmc.StreamInfo {
 		sie.Video.Width = 1920
 		sie.Video.Height = 1080
 		break
+	case Resolution1440p:
+		sie.Video.Width = 2560
+		sie.Video.Height = 1440
+		break
+	case Resolution4k2k:
+		sie.Video.Width = 3840
+		sie.Video.Height = 2160
+		break
 	}
 
 	return sie
@@ -1,14 +1,15 @@
 package bittorrent
 
 import (
-	"bufio"
 	"bytes"
 	"encoding/binary"
 	"encoding/hex"
 	"errors"
+	"fmt"
 	"math/rand"
 	"net"
 	"net/url"
+	"regexp"
 	"strings"
 	"time"
 )
@@ -20,11 +21,41 @@ const (
 	MaxScrapeHashes                  = 70
 )
 
+// As per BEP 15, requests are retransmitted after 15 * 2 ^ n seconds, n going
+// from 0 up to 8. That's way too long when someone is waiting in front of the
+// TV, so by default trackers use the same schedule with a lower base timeout
+// and fewer retries.
+const (
+	BEP15Timeout          = 15 * time.Second
+	BEP15MaxRetries       = 8
+	InteractiveTimeout    = 1 * time.Second
+	InteractiveMaxRetries = 1
+
+	// A client can use a connection ID until one minute after it has received
+	// it, trackers accept it for two minutes.
+	ConnectionIdLifetime = 1 * time.Minute
+)
+
 const (
 	ActionConnect Action = iota
 	ActionAnnounce
 	ActionScrape
-	ActionError = 50331648 // it's LittleEndian(3), in BigEndian, don't ask
+	ActionError
+	actionErrorLE = 50331648 // some trackers send LittleEndian(3), don't ask
+)
+
+const (
+	trackerResponseSize    = 8
+	connectionResponseSize = trackerResponseSize + 8
+	scrapeEntrySize        = 12
+)
+
+var (
+	// private trackers put passkeys in the path, /0123456789abcdef/announce
+	trackerPasskeyPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{16,}$`)
+
+	ErrTrackerTimeout       = errors.New("Request timed out.")
+	ErrTrackerShortResponse = errors.New("Response is too short.")
 )
 
 type Action int32
@@ -74,12 +105,52 @@ type ScrapeResponseEntry struct {
 	Leechers  int32
 }
 
+// Scraper is implemented by every tracker protocol we know how to fetch
+// swarm metrics from. Scrape must return exactly one entry per torrent, in
+// order, leaving unknown entries zeroed. When some of the hashes could not be
+// scraped, Scrape still returns all the entries along with the first error
+// encountered.
+type Scraper interface {
+	Connect() error
+	Scrape(torrents []*Torrent) ([]ScrapeResponseEntry, error)
+	Close() error
+	String() string
+}
+
 type Tracker struct {
 	connection   net.Conn
-	reader       *bufio.Reader
-	writer       *bufio.Writer
+	buffer       []byte
 	connectionId int64
+	connectedAt  time.Time
 	URL          *url.URL
+
+	// Requests are retransmitted after Timeout * 2 ^ n, n going from 0 to
+	// MaxRetries.
+	Timeout    time.Duration
+	MaxRetries int
+}
+
+// NewScraper returns the Scraper matching the tracker URL scheme.
+func NewScraper(trackerUrl string) (Scraper, error) {
+	tURL, err := url.Parse(trackerUrl)
+	if err != nil {
+		return nil, err
+	}
+	switch tURL.Scheme {
+	case "udp":
+		tracker, err := NewTracker(trackerUrl)
+		if err != nil {
+			return nil, err
+		}
+		return tracker, nil
+	case "http", "https":
+		tracker, err := NewHTTPTracker(trackerUrl)
+		if err != nil {
+			return nil, err
+		}
+		return tracker, nil
+	}
+	return nil, errors.New("Unsupported tracker scheme.")
 }
 
 func NewTracker(trackerUrl string) (tracker *Tracker, err error) {
@@ -91,82 +162,139 @@ func NewTracker(trackerUrl string) (tracker *Tracker, err error) {
 		err = errors.New("Only UDP trackers are supported.")
 		return
 	}
+	if strings.Index(tURL.Host, ":") < 0 {
+		tURL.Host += ":80"
+	}
+	// UDP trackers are identified by their host only, drop the path so that
+	// the same tracker announced with and without /announce is scraped once.
+	tURL.Path = ""
+	tURL.RawQuery = ""
 	tracker = &Tracker{
 		connectionId: ConnectionRequestInitialId,
 		URL:          tURL,
+		Timeout:      InteractiveTimeout,
+		MaxRetries:   InteractiveMaxRetries,
 	}
 	return
 }
 
-func (tracker *Tracker) sendRequest(action Action, request interface{}) error {
-	trackerRequest := TrackerRequest{
-		ConnectionId:  tracker.connectionId,
-		Action:        action,
-		TransactionId: rand.Int31(),
-	}
-	binary.Write(tracker.writer, binary.BigEndian, trackerRequest)
-	if request != nil {
-		binary.Write(tracker.writer, binary.BigEndian, request)
-	}
-	tracker.writer.Flush()
+func (tracker *Tracker) connectionExpired() bool {
+	return time.Since(tracker.connectedAt) > ConnectionIdLifetime
+}
 
-	trackerResponse := TrackerResponse{}
+// sendRequest sends the request and waits for the matching response,
+// retransmitting it as per BEP 15. It returns the response payload, without
+// the action and transaction id header.
+func (tracker *Tracker) sendRequest(action Action, request interface{}) ([]byte, error) {
+	for retry := 0; retry <= tracker.MaxRetries; retry++ {
+		if action != ActionConnect && tracker.connectionExpired() {
+			if err := tracker.connect(); err != nil {
+				return nil, err
+			}
+		}
 
-	result := make(chan error, 1)
-	go func() {
-		result <- binary.Read(tracker.reader, binary.BigEndian, &trackerResponse)
-	}()
-	select {
-	case <-time.After(DefaultTimeout):
-		return errors.New("Request timed out.")
-	case err := <-result:
-		if err != nil {
-			return err
+		trackerRequest := TrackerRequest{
+			ConnectionId:  tracker.connectionId,
+			Action:        action,
+			TransactionId: rand.Int31(),
+		}
+		packet := bytes.NewBuffer(nil)
+		binary.Write(packet, binary.BigEndian, trackerRequest)
+		if request != nil {
+			binary.Write(packet, binary.BigEndian, request)
+		}
+		if _, err := tracker.connection.Write(packet.Bytes()); err != nil {
+			return nil, err
 		}
-	}
 
-	if trackerResponse.TransactionId != trackerRequest.TransactionId {
-		return errors.New("Request/Response Transaction missmatch.")
+		timeout := tracker.Timeout * time.Duration(1<<uint(retry))
+		payload, err := tracker.readResponse(trackerRequest, time.Now().Add(timeout))
+		if err == ErrTrackerTimeout {
+			continue
+		}
+		return payload, err
 	}
-	if trackerResponse.Action == ActionError {
-		msg, err := tracker.reader.ReadString(0)
+	return nil, ErrTrackerTimeout
+}
+
+// readResponse waits for the response to trackerRequest until deadline.
+// Datagrams that can't be it are dropped, as per BEP 15.
+func (tracker *Tracker) readResponse(trackerRequest TrackerRequest, deadline time.Time) ([]byte, error) {
+	tracker.connection.SetReadDeadline(deadline)
+	for {
+		n, err := tracker.connection.Read(tracker.buffer)
 		if err != nil {
-			return err
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				return nil, ErrTrackerTimeout
+			}
+			return nil, err
+		}
+		if n < trackerResponseSize {
+			continue
+		}
+
+		trackerResponse := TrackerResponse{}
+		binary.Read(bytes.NewReader(tracker.buffer[:trackerResponseSize]), binary.BigEndian, &trackerResponse)
+
+		// late response to a previous retransmission, keep waiting
+		if trackerResponse.TransactionId != trackerRequest.TransactionId {
+			continue
+		}
+
+		payload := tracker.buffer[trackerResponseSize:n]
+		switch trackerResponse.Action {
+		case ActionError, actionErrorLE:
+			return nil, errors.New(string(bytes.TrimRight(payload, "\x00")))
+		case trackerRequest.Action:
+			return payload, nil
 		}
-		return errors.New(msg)
 	}
+}
 
+func (tracker *Tracker) connect() error {
+	tracker.connectionId = ConnectionRequestInitialId
+	payload, err := tracker.sendRequest(ActionConnect, nil)
+	if err != nil {
+		return err
+	}
+	if len(payload) < connectionResponseSize-trackerResponseSize {
+		return ErrTrackerShortResponse
+	}
+	if err := binary.Read(bytes.NewReader(payload), binary.BigEndian, &tracker.connectionId); err != nil {
+		return err
+	}
+	tracker.connectedAt = time.Now()
 	return nil
 }
 
 func (tracker *Tracker) Connect() error {
-	if strings.Index(tracker.URL.Host, ":") < 0 {
-		tracker.URL.Host += ":80"
-	}
 	var err error
 	tracker.connection, err = net.DialTimeout("udp", tracker.URL.Host, DefaultTimeout)
 	if err != nil {
 		return err
 	}
-	tracker.reader = bufio.NewReaderSize(tracker.connection, DefaultBufferSize)
-	tracker.writer = bufio.NewWriterSize(tracker.connection, DefaultBufferSize)
-	if err := tracker.sendRequest(ActionConnect, nil); err != nil {
-		return err
-	}
-	return binary.Read(tracker.reader, binary.BigEndian, &tracker.connectionId)
+	tracker.buffer = make([]byte, DefaultBufferSize)
+	return tracker.connect()
 }
 
-func (tracker *Tracker) doScrape(infoHashes [][]byte) []ScrapeResponseEntry {
-	if err := tracker.sendRequest(ActionScrape, bytes.Join(infoHashes, nil)); err != nil {
-		return nil
+func (tracker *Tracker) doScrape(infoHashes [][]byte) ([]ScrapeResponseEntry, error) {
+	payload, err := tracker.sendRequest(ActionScrape, bytes.Join(infoHashes, nil))
+	if err != nil {
+		return nil, err
+	}
+	if len(payload) < len(infoHashes)*scrapeEntrySize {
+		return nil, ErrTrackerShortResponse
 	}
 
 	entries := make([]ScrapeResponseEntry, len(infoHashes))
-	binary.Read(tracker.reader, binary.BigEndian, &entries)
-	return entries
+	if err := binary.Read(bytes.NewReader(payload), binary.BigEndian, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
 }
 
-func (tracker *Tracker) Scrape(torrents []*Torrent) []ScrapeResponseEntry {
+func (tracker *Tracker) Scrape(torrents []*Torrent) ([]ScrapeResponseEntry, error) {
+	var scrapeErr error
 	entries := make([]ScrapeResponseEntry, 0, len(torrents))
 
 	infoHashes := make([][]byte, 0, len(torrents))
@@ -175,18 +303,56 @@ func (tracker *Tracker) Scrape(torrents []*Torrent) []ScrapeResponseEntry {
 		infoHashes = append(infoHashes, bhash)
 	}
 
-	for i := 0; i <= len(infoHashes)/MaxScrapeHashes; i++ {
-		idx := i * MaxScrapeHashes
+	for idx := 0; idx < len(infoHashes); idx += MaxScrapeHashes {
 		max := idx + MaxScrapeHashes
 		if max > len(infoHashes) {
 			max = len(infoHashes)
 		}
-		entries = append(entries, tracker.doScrape(infoHashes[idx:max])...)
+		batch, err := tracker.doScrape(infoHashes[idx:max])
+		if err != nil {
+			if scrapeErr == nil {
+				scrapeErr = fmt.Errorf("scrape failed for %d hashes: %s", max-idx, err)
+			}
+			// keep entries aligned with torrents
+			batch = make([]ScrapeResponseEntry, max-idx)
+		}
+		entries = append(entries, batch...)
 	}
 
-	return entries
+	return entries, scrapeErr
+}
+
+func (tracker *Tracker) Close() error {
+	if tracker.connection == nil {
+		return nil
+	}
+	return tracker.connection.Close()
 }
 
 func (tracker *Tracker) String() string {
-	return tracker.URL.String()
+	return RedactTrackerURL(tracker.URL.String())
+}
+
+// RedactTrackerURL removes the credentials of private trackers from a
+// tracker URL, so that it can be logged and saved: user info, query values
+// and path components that look like passkeys.
+func RedactTrackerURL(trackerUrl string) string {
+	u, err := url.Parse(trackerUrl)
+	if err != nil {
+		return "invalid tracker URL"
+	}
+	u.User = nil
+	segments := strings.Split(u.Path, "/")
+	for i, segment := range segments {
+		if trackerPasskeyPattern.MatchString(segment) {
+			segments[i] = "redacted"
+		}
+	}
+	u.Path = strings.Join(segments, "/")
+	query := u.Query()
+	for key := range query {
+		query.Set(key, "redacted")
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
 }
@@ -0,0 +1,151 @@
+package bittorrent
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/steeve/pulsar/util"
+	"github.com/zeebo/bencode"
+)
+
+var (
+	httpTrackerClient = &http.Client{
+		Transport: httpClient.Transport,
+		Timeout:   DefaultTimeout,
+	}
+)
+
+type httpScrapeEntry struct {
+	Complete   int32 `bencode:"complete"`
+	Downloaded int32 `bencode:"downloaded"`
+	Incomplete int32 `bencode:"incomplete"`
+}
+
+type httpScrapeResponse struct {
+	Files         map[string]httpScrapeEntry `bencode:"files"`
+	FailureReason string                     `bencode:"failure reason"`
+}
+
+// HTTPTracker scrapes HTTP/HTTPS trackers following the scrape convention:
+// the last path component of the announce URL starting with "announce" is
+// replaced by "scrape", and the info hashes are passed as query parameters.
+type HTTPTracker struct {
+	URL *url.URL
+}
+
+func NewHTTPTracker(trackerUrl string) (tracker *HTTPTracker, err error) {
+	tURL, err := url.Parse(trackerUrl)
+	if err != nil {
+		return
+	}
+	if tURL.Scheme != "http" && tURL.Scheme != "https" {
+		err = errors.New("Only HTTP trackers are supported.")
+		return
+	}
+	dir, file := path.Split(tURL.Path)
+	if strings.HasPrefix(file, "announce") == false {
+		err = errors.New("Tracker does not support scraping.")
+		return
+	}
+	tURL.Path = dir + "scrape" + strings.TrimPrefix(file, "announce")
+	tracker = &HTTPTracker{
+		URL: tURL,
+	}
+	return
+}
+
+// Connect is a no-op, HTTP trackers are stateless.
+func (tracker *HTTPTracker) Connect() error {
+	return nil
+}
+
+func (tracker *HTTPTracker) doScrape(infoHashes [][]byte) ([]ScrapeResponseEntry, error) {
+	scrapeURL := *tracker.URL
+	query := scrapeURL.Query()
+	for _, infoHash := range infoHashes {
+		query.Add("info_hash", string(infoHash))
+	}
+	scrapeURL.RawQuery = query.Encode()
+
+	req, err := http.NewRequest("GET", scrapeURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", util.UserAgent())
+
+	resp, err := httpTrackerClient.Do(req)
+	if err != nil {
+		// errors of the client quote the URL, passkey included
+		if urlErr, ok := err.(*url.Error); ok {
+			urlErr.URL = RedactTrackerURL(urlErr.URL)
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Unexpected HTTP status: %s", resp.Status)
+	}
+
+	scrapeResponse := httpScrapeResponse{}
+	if err := bencode.NewDecoder(resp.Body).Decode(&scrapeResponse); err != nil {
+		return nil, err
+	}
+	if scrapeResponse.FailureReason != "" {
+		return nil, errors.New(scrapeResponse.FailureReason)
+	}
+
+	entries := make([]ScrapeResponseEntry, len(infoHashes))
+	for i, infoHash := range infoHashes {
+		if file, ok := scrapeResponse.Files[string(infoHash)]; ok {
+			entries[i] = ScrapeResponseEntry{
+				Seeders:   file.Complete,
+				Completed: file.Downloaded,
+				Leechers:  file.Incomplete,
+			}
+		}
+	}
+	return entries, nil
+}
+
+func (tracker *HTTPTracker) Scrape(torrents []*Torrent) ([]ScrapeResponseEntry, error) {
+	var scrapeErr error
+	entries := make([]ScrapeResponseEntry, 0, len(torrents))
+
+	infoHashes := make([][]byte, 0, len(torrents))
+	for _, torrent := range torrents {
+		bhash, _ := hex.DecodeString(torrent.InfoHash)
+		infoHashes = append(infoHashes, bhash)
+	}
+
+	for idx := 0; idx < len(infoHashes); idx += MaxScrapeHashes {
+		max := idx + MaxScrapeHashes
+		if max > len(infoHashes) {
+			max = len(infoHashes)
+		}
+		batch, err := tracker.doScrape(infoHashes[idx:max])
+		if err != nil {
+			if scrapeErr == nil {
+				scrapeErr = fmt.Errorf("scrape failed for %d hashes: %s", max-idx, err)
+			}
+			batch = make([]ScrapeResponseEntry, max-idx)
+		}
+		entries = append(entries, batch...)
+	}
+
+	return entries, scrapeErr
+}
+
+// Close is a no-op, HTTP trackers are stateless.
+func (tracker *HTTPTracker) Close() error {
+	return nil
+}
+
+// String returns the scrape URL, without passkeys.
+func (tracker *HTTPTracker) String() string {
+	return RedactTrackerURL(tracker.URL.String())
+}
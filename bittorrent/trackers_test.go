@@ -0,0 +1,338 @@
+package bittorrent
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testTrackerTimeout = 50 * time.Millisecond
+
+type fakeTrackerRequest struct {
+	TrackerRequest
+	Payload  []byte
+	Received time.Time
+}
+
+// fakeTracker is a UDP tracker on localhost answering each request with what
+// handle returns, nothing if nil.
+type fakeTracker struct {
+	conn   net.PacketConn
+	handle func(request fakeTrackerRequest) [][]byte
+
+	mu       sync.Mutex
+	requests []fakeTrackerRequest
+}
+
+func newFakeTracker(t *testing.T, handle func(request fakeTrackerRequest) [][]byte) *fakeTracker {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ft := &fakeTracker{conn: conn, handle: handle}
+	go ft.serve()
+	return ft
+}
+
+func (ft *fakeTracker) serve() {
+	buffer := make([]byte, DefaultBufferSize)
+	for {
+		n, addr, err := ft.conn.ReadFrom(buffer)
+		if err != nil {
+			return
+		}
+		request := fakeTrackerRequest{Received: time.Now()}
+		binary.Read(bytes.NewReader(buffer[:n]), binary.BigEndian, &request.TrackerRequest)
+		request.Payload = append([]byte(nil), buffer[16:n]...)
+
+		ft.mu.Lock()
+		ft.requests = append(ft.requests, request)
+		ft.mu.Unlock()
+
+		for _, response := range ft.handle(request) {
+			ft.conn.WriteTo(response, addr)
+		}
+	}
+}
+
+func (ft *fakeTracker) Requests() []fakeTrackerRequest {
+	ft.mu.Lock()
+	defer ft.mu.Unlock()
+	return append([]fakeTrackerRequest(nil), ft.requests...)
+}
+
+func (ft *fakeTracker) Close() {
+	ft.conn.Close()
+}
+
+// tracker returns a connected Tracker to ft.
+func (ft *fakeTracker) tracker(t *testing.T) *Tracker {
+	tracker := ft.newTracker(t)
+	if err := tracker.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	return tracker
+}
+
+func (ft *fakeTracker) newTracker(t *testing.T) *Tracker {
+	tracker, err := NewTracker("udp://" + ft.conn.LocalAddr().String() + "/announce")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracker.Timeout = testTrackerTimeout
+	tracker.MaxRetries = 2
+	return tracker
+}
+
+func trackerPacket(action Action, transactionId int32, payload ...interface{}) []byte {
+	packet := bytes.NewBuffer(nil)
+	binary.Write(packet, binary.BigEndian, TrackerResponse{action, transactionId})
+	for _, p := range payload {
+		binary.Write(packet, binary.BigEndian, p)
+	}
+	return packet.Bytes()
+}
+
+// answer is a well behaved tracker giving connectionId to its clients, and
+// the position of each info hash as its seeders.
+func answer(connectionId int64) func(request fakeTrackerRequest) [][]byte {
+	return func(request fakeTrackerRequest) [][]byte {
+		if request.Action == ActionConnect {
+			return [][]byte{trackerPacket(ActionConnect, request.TransactionId, connectionId)}
+		}
+		entries := make([]ScrapeResponseEntry, len(request.Payload)/20)
+		for i := range entries {
+			entries[i].Seeders = int32(i + 1)
+		}
+		return [][]byte{trackerPacket(ActionScrape, request.TransactionId, entries)}
+	}
+}
+
+func testTorrents(count int) []*Torrent {
+	torrents := make([]*Torrent, count)
+	for i := range torrents {
+		torrents[i] = &Torrent{InfoHash: strings.Repeat("ab", 20)}
+	}
+	return torrents
+}
+
+func TestTrackerScrape(t *testing.T) {
+	ft := newFakeTracker(t, answer(42))
+	defer ft.Close()
+	tracker := ft.tracker(t)
+	defer tracker.Close()
+
+	entries, err := tracker.Scrape(testTorrents(MaxScrapeHashes + 5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != MaxScrapeHashes+5 {
+		t.Fatalf("got %d entries, want %d", len(entries), MaxScrapeHashes+5)
+	}
+	if entries[0].Seeders != 1 || entries[MaxScrapeHashes].Seeders != 1 || entries[MaxScrapeHashes+4].Seeders != 5 {
+		t.Errorf("entries are out of order: %v", entries)
+	}
+
+	requests := ft.Requests()
+	if len(requests) != 3 {
+		t.Fatalf("got %d requests, want a connect and 2 scrapes", len(requests))
+	}
+	if requests[0].ConnectionId != ConnectionRequestInitialId {
+		t.Errorf("connect used connection ID %#x", requests[0].ConnectionId)
+	}
+	for _, request := range requests[1:] {
+		if request.Action != ActionScrape || request.ConnectionId != 42 {
+			t.Errorf("got action %d with connection ID %d, want a scrape with 42", request.Action, request.ConnectionId)
+		}
+	}
+}
+
+func TestTrackerRetransmission(t *testing.T) {
+	dropped := 0
+	ft := newFakeTracker(t, func(request fakeTrackerRequest) [][]byte {
+		if dropped < 2 {
+			dropped++
+			return nil
+		}
+		return answer(42)(request)
+	})
+	defer ft.Close()
+	tracker := ft.tracker(t)
+	defer tracker.Close()
+
+	requests := ft.Requests()
+	if len(requests) != 3 {
+		t.Fatalf("got %d connect requests, want 3", len(requests))
+	}
+	// retransmitted after Timeout, then 2 * Timeout, give or take timers
+	// rounding and scheduling
+	for i, want := range []time.Duration{testTrackerTimeout, 2 * testTrackerTimeout} {
+		if wait := requests[i+1].Received.Sub(requests[i].Received); wait < want*8/10 || wait > want+time.Second {
+			t.Errorf("retransmission %d after %s, want %s", i+1, wait, want)
+		}
+		if requests[i+1].TransactionId == requests[i].TransactionId {
+			t.Errorf("retransmission %d reused transaction ID %d", i+1, requests[i].TransactionId)
+		}
+	}
+}
+
+func TestTrackerTimeout(t *testing.T) {
+	ft := newFakeTracker(t, func(request fakeTrackerRequest) [][]byte {
+		return nil
+	})
+	defer ft.Close()
+	tracker := ft.newTracker(t)
+	tracker.MaxRetries = 1
+	defer tracker.Close()
+
+	started := time.Now()
+	if err := tracker.Connect(); err != ErrTrackerTimeout {
+		t.Fatalf("got %v, want %v", err, ErrTrackerTimeout)
+	}
+	if elapsed := time.Since(started); elapsed < 3*testTrackerTimeout {
+		t.Errorf("gave up after %s, want at least %s", elapsed, 3*testTrackerTimeout)
+	}
+	if requests := ft.Requests(); len(requests) != 2 {
+		t.Errorf("got %d requests, want 2", len(requests))
+	}
+}
+
+func TestTrackerConnectionIdExpiry(t *testing.T) {
+	connectionId := int64(0)
+	ft := newFakeTracker(t, func(request fakeTrackerRequest) [][]byte {
+		if request.Action == ActionConnect {
+			connectionId++
+		}
+		return answer(connectionId)(request)
+	})
+	defer ft.Close()
+	tracker := ft.tracker(t)
+	defer tracker.Close()
+
+	tracker.connectedAt = time.Now().Add(-ConnectionIdLifetime - time.Second)
+	if _, err := tracker.Scrape(testTorrents(1)); err != nil {
+		t.Fatal(err)
+	}
+
+	requests := ft.Requests()
+	if len(requests) != 3 || requests[1].Action != ActionConnect || requests[2].Action != ActionScrape {
+		t.Fatalf("got %v, want connect, connect and scrape", requests)
+	}
+	if requests[1].ConnectionId != ConnectionRequestInitialId {
+		t.Errorf("reconnected with connection ID %d", requests[1].ConnectionId)
+	}
+	if requests[2].ConnectionId != 2 {
+		t.Errorf("scraped with connection ID %d, want the new one", requests[2].ConnectionId)
+	}
+}
+
+func TestTrackerShortResponse(t *testing.T) {
+	t.Run("header", func(t *testing.T) {
+		ft := newFakeTracker(t, func(request fakeTrackerRequest) [][]byte {
+			return [][]byte{{0, 0, 0, 0}}
+		})
+		defer ft.Close()
+		tracker := ft.newTracker(t)
+		defer tracker.Close()
+		if err := tracker.Connect(); err != ErrTrackerTimeout {
+			t.Errorf("got %v, want %v", err, ErrTrackerTimeout)
+		}
+	})
+
+	t.Run("connect", func(t *testing.T) {
+		ft := newFakeTracker(t, func(request fakeTrackerRequest) [][]byte {
+			return [][]byte{trackerPacket(ActionConnect, request.TransactionId, int32(42))}
+		})
+		defer ft.Close()
+		tracker := ft.newTracker(t)
+		defer tracker.Close()
+		if err := tracker.Connect(); err != ErrTrackerShortResponse {
+			t.Errorf("got %v, want %v", err, ErrTrackerShortResponse)
+		}
+	})
+
+	t.Run("scrape", func(t *testing.T) {
+		ft := newFakeTracker(t, func(request fakeTrackerRequest) [][]byte {
+			if request.Action == ActionConnect {
+				return answer(42)(request)
+			}
+			return [][]byte{trackerPacket(ActionScrape, request.TransactionId, ScrapeResponseEntry{Seeders: 1})}
+		})
+		defer ft.Close()
+		tracker := ft.tracker(t)
+		defer tracker.Close()
+
+		entries, err := tracker.Scrape(testTorrents(2))
+		if err == nil || strings.Contains(err.Error(), ErrTrackerShortResponse.Error()) == false {
+			t.Errorf("got %v, want %v", err, ErrTrackerShortResponse)
+		}
+		if len(entries) != 2 || entries[0].Seeders != 0 {
+			t.Errorf("got %v, want 2 zeroed entries", entries)
+		}
+	})
+}
+
+func TestTrackerDropsJunk(t *testing.T) {
+	ft := newFakeTracker(t, func(request fakeTrackerRequest) [][]byte {
+		return append([][]byte{
+			{0, 0, 0, 0},
+			trackerPacket(ActionAnnounce, request.TransactionId),
+		}, answer(42)(request)...)
+	})
+	defer ft.Close()
+	tracker := ft.tracker(t)
+	defer tracker.Close()
+
+	if _, err := tracker.Scrape(testTorrents(1)); err != nil {
+		t.Fatal(err)
+	}
+	if requests := ft.Requests(); len(requests) != 2 {
+		t.Errorf("got %d requests, junk shouldn't cause retransmissions", len(requests))
+	}
+}
+
+func TestTrackerErrorAction(t *testing.T) {
+	for _, action := range []Action{ActionError, actionErrorLE} {
+		ft := newFakeTracker(t, func(request fakeTrackerRequest) [][]byte {
+			if request.Action == ActionConnect {
+				return answer(42)(request)
+			}
+			return [][]byte{trackerPacket(action, request.TransactionId, []byte("torrent not registered\x00"))}
+		})
+		tracker := ft.tracker(t)
+
+		_, err := tracker.Scrape(testTorrents(1))
+		if err == nil || strings.HasSuffix(err.Error(), ": torrent not registered") == false {
+			t.Errorf("action %d: got %v, want the message of the tracker", action, err)
+		}
+		if requests := ft.Requests(); len(requests) != 2 {
+			t.Errorf("action %d: got %d requests, errors shouldn't be retried", action, len(requests))
+		}
+
+		tracker.Close()
+		ft.Close()
+	}
+}
+
+func TestTrackerTransactionIdMismatch(t *testing.T) {
+	ft := newFakeTracker(t, func(request fakeTrackerRequest) [][]byte {
+		return [][]byte{
+			trackerPacket(ActionConnect, request.TransactionId+1, int64(666)),
+			trackerPacket(ActionConnect, request.TransactionId, int64(42)),
+		}
+	})
+	defer ft.Close()
+	tracker := ft.tracker(t)
+	defer tracker.Close()
+
+	if tracker.connectionId != 42 {
+		t.Errorf("got connection ID %d, want 42", tracker.connectionId)
+	}
+	if requests := ft.Requests(); len(requests) != 1 {
+		t.Errorf("got %d requests, the mismatched response should be skipped without retransmitting", len(requests))
+	}
+}
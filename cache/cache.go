@@ -1,11 +1,15 @@
 package cache
 
 import (
+	"bytes"
 	"crypto/sha1"
 	"encoding/hex"
 	"errors"
 	"io"
+	"io/ioutil"
 	"net/http"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -16,6 +20,13 @@ const (
 	DEFAULT              = time.Duration(0)
 	FOREVER              = time.Duration(-1)
 	CACHE_MIDDLEWARE_KEY = "gincontrib.cache"
+
+	// RefreshHeader is set on the requests Pulsar makes to itself to update
+	// cached pages. They skip the cache, and aren't page views.
+	RefreshHeader = "X-Pulsar-Cache-Refresh"
+
+	// a hung handler mustn't block the refreshes of its page forever
+	refreshTimeout = 2 * time.Minute
 )
 
 var (
@@ -24,6 +35,9 @@ var (
 	ErrNotStored    = errors.New("cache: not stored.")
 	ErrNotSupport   = errors.New("cache: not support.")
 	log             = logging.MustGetLogger("btplayer")
+
+	refreshes     = flightGroup{}
+	refreshClient = &http.Client{Timeout: refreshTimeout}
 )
 
 type CacheStore interface {
@@ -38,18 +52,35 @@ type CacheStore interface {
 }
 
 type responseCache struct {
-	Status int
-	Header http.Header
-	Data   []byte
+	Status  int
+	Header  http.Header
+	Data    []byte
+	Expires time.Time // stale after that
 }
 
 type cachedWriter struct {
 	gin.ResponseWriter
 	status  int
 	written bool
-	store   CacheStore
-	expire  time.Duration
-	key     string
+	body    bytes.Buffer
+}
+
+// PageCacheStats counts how the pages under the Cache middleware were served.
+type PageCacheStats struct {
+	Hits   uint64 `json:"hits"`
+	Stale  uint64 `json:"stale"` // served while being refreshed
+	Misses uint64 `json:"misses"`
+}
+
+var pageCacheStats PageCacheStats
+
+// GetPageCacheStats returns the page cache counters since startup.
+func GetPageCacheStats() PageCacheStats {
+	return PageCacheStats{
+		Hits:   atomic.LoadUint64(&pageCacheStats.Hits),
+		Stale:  atomic.LoadUint64(&pageCacheStats.Stale),
+		Misses: atomic.LoadUint64(&pageCacheStats.Misses),
+	}
 }
 
 func cacheKey(prefix string, u string) string {
@@ -58,8 +89,8 @@ func cacheKey(prefix string, u string) string {
 	return prefix + ":" + hex.EncodeToString(h.Sum(nil))
 }
 
-func newCachedWriter(store CacheStore, expire time.Duration, writer gin.ResponseWriter, key string) *cachedWriter {
-	return &cachedWriter{writer, 0, false, store, expire, key}
+func newCachedWriter(writer gin.ResponseWriter) *cachedWriter {
+	return &cachedWriter{ResponseWriter: writer}
 }
 
 func (w *cachedWriter) WriteHeader(code int) {
@@ -69,6 +100,9 @@ func (w *cachedWriter) WriteHeader(code int) {
 }
 
 func (w *cachedWriter) Status() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
 	return w.status
 }
 
@@ -76,43 +110,105 @@ func (w *cachedWriter) Written() bool {
 	return w.written
 }
 
+// Write passes data through, and keeps a copy of the whole body to cache it
+// once the handlers are done.
 func (w *cachedWriter) Write(data []byte) (int, error) {
 	ret, err := w.ResponseWriter.Write(data)
 	if err == nil {
-		//cache response
-		store := w.store
-		val := responseCache{
-			w.status,
-			w.Header(),
-			data,
-		}
-		err = store.Set(w.key, val, w.expire)
-		if err != nil {
-			// need logger
-		}
+		w.body.Write(data[:ret])
+	}
+	return ret, err
+}
+
+// WriteString is like Write, for the handlers writing strings.
+func (w *cachedWriter) WriteString(data string) (int, error) {
+	ret, err := w.ResponseWriter.WriteString(data)
+	if err == nil {
+		w.body.WriteString(data[:ret])
 	}
 	return ret, err
 }
 
-// Cache Middleware
-func Cache(store CacheStore, expire time.Duration) gin.HandlerFunc {
+// cacheable returns true for successful responses whose handler didn't opt
+// out with Cache-Control: no-store.
+func (w *cachedWriter) cacheable() bool {
+	if w.Status() < 200 || w.Status() >= 300 {
+		return false
+	}
+	return strings.Contains(strings.ToLower(w.Header().Get("Cache-Control")), "no-store") == false
+}
+
+// Cache Middleware. Only 2xx responses are cached, unless handlers set
+// Cache-Control: no-store. Expired pages are still served for stale while
+// they are refreshed in the background, so that slow pages only block the
+// first time.
+func Cache(store CacheStore, expire time.Duration, stale time.Duration) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		var cache responseCache
 		key := cacheKey(PageCachePrefix, ctx.Request.URL.RequestURI())
-		if err := store.Get(key, &cache); err == nil {
+		refreshing := ctx.Request.Header.Get(RefreshHeader) != ""
+		if err := store.Get(key, &cache); err == nil && refreshing == false {
+			if time.Now().After(cache.Expires) {
+				atomic.AddUint64(&pageCacheStats.Stale, 1)
+				go refresh(ctx.Request, key)
+			} else {
+				atomic.AddUint64(&pageCacheStats.Hits, 1)
+			}
 			for k, vals := range cache.Header {
 				for _, v := range vals {
 					ctx.Writer.Header().Add(k, v)
 				}
 			}
+			if cache.Status == 0 {
+				cache.Status = http.StatusOK
+			}
 			ctx.AbortWithStatus(cache.Status)
 			ctx.Writer.Write(cache.Data)
-		} else {
-			// replace writer
-			writer := ctx.Writer
-			ctx.Writer = newCachedWriter(store, expire, ctx.Writer, key)
-			ctx.Next()
-			ctx.Writer = writer
+			return
+		}
+
+		if refreshing == false {
+			atomic.AddUint64(&pageCacheStats.Misses, 1)
+		}
+		// replace writer
+		writer := ctx.Writer
+		cw := newCachedWriter(ctx.Writer)
+		ctx.Writer = cw
+		ctx.Next()
+		ctx.Writer = writer
+
+		if cw.cacheable() == false {
+			return
+		}
+		val := responseCache{
+			Status:  cw.Status(),
+			Header:  cw.Header(),
+			Data:    cw.body.Bytes(),
+			Expires: time.Now().Add(expire),
+		}
+		if err := store.Set(key, val, expire+stale); err != nil {
+			log.Warning("Unable to cache %s: %s", ctx.Request.URL.RequestURI(), err)
 		}
 	}
 }
+
+// refresh requests the page of req again, bypassing the cache. Concurrent
+// refreshes of the same page are merged.
+func refresh(req *http.Request, key string) {
+	u := "http://" + req.Host + req.URL.RequestURI()
+	refreshes.Do(key, func() (interface{}, error) {
+		refreshReq, err := http.NewRequest("GET", u, nil)
+		if err != nil {
+			return nil, err
+		}
+		refreshReq.Header.Set(RefreshHeader, "1")
+		resp, err := refreshClient.Do(refreshReq)
+		if err != nil {
+			log.Warning("Unable to refresh %s: %s", req.URL.RequestURI(), err)
+			return nil, err
+		}
+		defer resp.Body.Close()
+		io.Copy(ioutil.Discard, resp.Body)
+		return nil, nil
+	})
+}
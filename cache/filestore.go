@@ -4,15 +4,29 @@ import (
 	"compress/gzip"
 	"encoding/json"
 	"errors"
+	"io/ioutil"
 	"os"
 	"path"
+	"sort"
+	"strings"
 	"time"
 )
 
+const (
+	// entries are written to temporary files first, and then renamed
+	tempFilePrefix = ".tmp-"
+	// temporary files older than that were left by a crash
+	tempFileMaxAge = 1 * time.Hour
+)
+
 type FileStore struct {
 	path string
 }
 
+// fetches are shared by all the stores, as stores are usually created
+// on the fly for the same directories
+var fetches = flightGroup{}
+
 type fileStoreItem struct {
 	Key     string      `json:"key"`
 	Value   interface{} `json:"value"`
@@ -24,28 +38,70 @@ func NewFileStore(path string) *FileStore {
 	return &FileStore{path}
 }
 
+// Set writes the entry to a temporary file, and renames it once complete, so
+// that readers never see partial entries.
 func (c *FileStore) Set(key string, value interface{}, expires time.Duration) error {
-	filename := path.Join(c.path, key)
-	file, err := os.Create(filename)
+	file, err := ioutil.TempFile(c.path, tempFilePrefix)
 	if err != nil {
 		return err
 	}
-	defer file.Close()
+	tempName := file.Name()
 
 	gzWriter := gzip.NewWriter(file)
-	defer gzWriter.Close()
-
 	item := fileStoreItem{
 		Key:     key,
 		Value:   value,
 		Expires: time.Now().UTC().Add(expires),
 	}
+	err = json.NewEncoder(gzWriter).Encode(item)
+	if closeErr := gzWriter.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tempName, path.Join(c.path, key))
+	}
+	if err != nil {
+		os.Remove(tempName)
+	}
+	return err
+}
 
-	return json.NewEncoder(gzWriter).Encode(item)
+// Fetch gets key into value. On misses, it calls fetch and stores its result
+// for expires. Concurrent misses of the same key only call fetch once, and
+// share its result. Nil results aren't stored, and return ErrNotStored.
+func (c *FileStore) Fetch(key string, value interface{}, expires time.Duration, fetch func() (interface{}, error)) error {
+	if err := c.Get(key, value); err == nil {
+		return nil
+	}
+	result, err := fetches.Do(path.Join(c.path, key), func() (interface{}, error) {
+		result, err := fetch()
+		if err != nil {
+			return nil, err
+		}
+		if result == nil {
+			return nil, ErrNotStored
+		}
+		if err := c.Set(key, result, expires); err != nil {
+			log.Warning("Unable to cache %s: %s", key, err)
+		}
+		return result, nil
+	})
+	if err != nil {
+		return err
+	}
+	// callers must not share the result
+	data, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, value)
 }
 
 func (c *FileStore) Add(key string, value interface{}, expires time.Duration) error {
-	if _, err := os.Stat(path.Join(c.path, key)); os.IsExist(err) {
+	if _, err := os.Stat(path.Join(c.path, key)); err == nil {
 		return os.ErrExist
 	}
 	return c.Set(key, value, expires)
@@ -59,31 +115,47 @@ func (c *FileStore) Replace(key string, value interface{}, expires time.Duration
 }
 
 func (c *FileStore) Get(key string, value interface{}) error {
-	file, err := os.Open(path.Join(c.path, key))
-	if err != nil {
-		return err
-	}
-	defer file.Close()
+	_, err := c.get(key, value)
+	return err
+}
 
-	gzReader, err := gzip.NewReader(file)
+// get is Get, but also returns when the key expires, so that faster stores
+// layered on top don't keep it longer.
+func (c *FileStore) get(key string, value interface{}) (time.Time, error) {
+	filename := path.Join(c.path, key)
+	file, err := os.Open(filename)
 	if err != nil {
-		return err
+		return time.Time{}, err
 	}
-	defer gzReader.Close()
+	defer file.Close()
 
 	item := fileStoreItem{
 		Value: value,
 	}
-	if err = json.NewDecoder(gzReader).Decode(&item); err != nil {
-		return err
+	gzReader, err := gzip.NewReader(file)
+	if err == nil {
+		err = json.NewDecoder(gzReader).Decode(&item)
+		gzReader.Close()
+	}
+	if err != nil {
+		// most likely written by an older version, or truncated by a crash
+		log.Warning("Removing corrupted cache entry %s: %s", key, err)
+		os.Remove(filename)
+		return time.Time{}, ErrCacheMiss
 	}
 	if item.Expires.Before(time.Now().UTC()) {
-		return errors.New("key is expired")
+		return time.Time{}, errors.New("key is expired")
 	}
-	return nil
+	return item.Expires, nil
 }
 
 func (c *FileStore) Delete(key string) error {
+	if err := os.Remove(path.Join(c.path, key)); err != nil {
+		if os.IsNotExist(err) {
+			return ErrCacheMiss
+		}
+		return err
+	}
 	return nil
 }
 
@@ -95,6 +167,106 @@ func (c *FileStore) Decrement(key string, delta uint64) (uint64, error) {
 	return 0, ErrNotSupport
 }
 
+// Flush removes all the entries of the store. Directories are left alone, as
+// are the temporary files of the writes in progress.
 func (c *FileStore) Flush() error {
-	return ErrNotSupport
+	files, err := ioutil.ReadDir(c.path)
+	if err != nil {
+		return err
+	}
+	for _, fi := range files {
+		if fi.IsDir() == false && strings.HasPrefix(fi.Name(), tempFilePrefix) == false {
+			os.Remove(path.Join(c.path, fi.Name()))
+		}
+	}
+	return nil
+}
+
+// expires returns when the entry of file expires, without decoding its value.
+func (c *FileStore) expires(file string) (time.Time, error) {
+	f, err := os.Open(path.Join(c.path, file))
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer f.Close()
+
+	gzReader, err := gzip.NewReader(f)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer gzReader.Close()
+
+	var item struct {
+		Expires time.Time `json:"expires"`
+	}
+	if err := json.NewDecoder(gzReader).Decode(&item); err != nil {
+		return time.Time{}, err
+	}
+	return item.Expires, nil
+}
+
+// Clean removes the expired and unreadable entries of the store, and then
+// the oldest ones until the store is no larger than maxSize bytes. A maxSize
+// of 0 means no size limit.
+func (c *FileStore) Clean(maxSize int64) (removed int, err error) {
+	files, err := ioutil.ReadDir(c.path)
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now().UTC()
+	kept := make([]os.FileInfo, 0, len(files))
+	size := int64(0)
+	for _, fi := range files {
+		if fi.IsDir() {
+			continue
+		}
+		if strings.HasPrefix(fi.Name(), tempFilePrefix) {
+			if now.Sub(fi.ModTime()) > tempFileMaxAge && os.Remove(path.Join(c.path, fi.Name())) == nil {
+				removed++
+			}
+			continue
+		}
+		if expires, err := c.expires(fi.Name()); err != nil || expires.Before(now) {
+			if os.Remove(path.Join(c.path, fi.Name())) == nil {
+				removed++
+			}
+			continue
+		}
+		kept = append(kept, fi)
+		size += fi.Size()
+	}
+
+	if maxSize > 0 && size > maxSize {
+		sort.Sort(byModTime(kept))
+		for _, fi := range kept {
+			if size <= maxSize {
+				break
+			}
+			if os.Remove(path.Join(c.path, fi.Name())) == nil {
+				removed++
+				size -= fi.Size()
+			}
+		}
+	}
+	return removed, nil
+}
+
+// RunJanitor cleans the store every interval, keeping it under maxSize bytes.
+// It never returns.
+func (c *FileStore) RunJanitor(interval time.Duration, maxSize int64) {
+	for {
+		if removed, err := c.Clean(maxSize); err != nil {
+			log.Error("Unable to clean cache %s: %s", c.path, err)
+		} else if removed > 0 {
+			log.Info("Removed %d entries from cache %s", removed, c.path)
+		}
+		time.Sleep(interval)
+	}
 }
+
+type byModTime []os.FileInfo
+
+func (a byModTime) Len() int           { return len(a) }
+func (a byModTime) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a byModTime) Less(i, j int) bool { return a[i].ModTime().Before(a[j].ModTime()) }
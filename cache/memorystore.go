@@ -0,0 +1,133 @@
+package cache
+
+import (
+	"container/list"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// MemoryStore is an in-memory CacheStore holding at most maxEntries entries.
+// The least recently used entries are evicted first. Values are stored
+// encoded, like in FileStore, so callers never share them.
+type MemoryStore struct {
+	mu         sync.Mutex
+	maxEntries int
+	entries    map[string]*list.Element
+	lru        *list.List // front is the most recently used
+}
+
+type memoryStoreItem struct {
+	key     string
+	data    []byte
+	expires time.Time
+}
+
+func NewMemoryStore(maxEntries int) *MemoryStore {
+	return &MemoryStore{
+		maxEntries: maxEntries,
+		entries:    make(map[string]*list.Element),
+		lru:        list.New(),
+	}
+}
+
+func (c *MemoryStore) Set(key string, value interface{}, expires time.Duration) error {
+	return c.set(key, value, time.Now().UTC().Add(expires))
+}
+
+func (c *MemoryStore) set(key string, value interface{}, expires time.Time) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, exists := c.entries[key]; exists {
+		item := element.Value.(*memoryStoreItem)
+		item.data = data
+		item.expires = expires
+		c.lru.MoveToFront(element)
+		return nil
+	}
+	c.entries[key] = c.lru.PushFront(&memoryStoreItem{key, data, expires})
+	for c.maxEntries > 0 && c.lru.Len() > c.maxEntries {
+		c.removeElement(c.lru.Back())
+	}
+	return nil
+}
+
+func (c *MemoryStore) Add(key string, value interface{}, expires time.Duration) error {
+	if c.exists(key) {
+		return os.ErrExist
+	}
+	return c.Set(key, value, expires)
+}
+
+func (c *MemoryStore) Replace(key string, value interface{}, expires time.Duration) error {
+	if c.exists(key) == false {
+		return os.ErrNotExist
+	}
+	return c.Set(key, value, expires)
+}
+
+func (c *MemoryStore) exists(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, exists := c.entries[key]
+	return exists
+}
+
+func (c *MemoryStore) Get(key string, value interface{}) error {
+	c.mu.Lock()
+	element, exists := c.entries[key]
+	if exists == false {
+		c.mu.Unlock()
+		return ErrCacheMiss
+	}
+	item := element.Value.(*memoryStoreItem)
+	if item.expires.Before(time.Now().UTC()) {
+		c.removeElement(element)
+		c.mu.Unlock()
+		return ErrCacheMiss
+	}
+	c.lru.MoveToFront(element)
+	data := item.data
+	c.mu.Unlock()
+
+	return json.Unmarshal(data, value)
+}
+
+func (c *MemoryStore) Delete(key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element, exists := c.entries[key]
+	if exists == false {
+		return ErrCacheMiss
+	}
+	c.removeElement(element)
+	return nil
+}
+
+// removeElement must be called with mu held.
+func (c *MemoryStore) removeElement(element *list.Element) {
+	c.lru.Remove(element)
+	delete(c.entries, element.Value.(*memoryStoreItem).key)
+}
+
+func (c *MemoryStore) Increment(key string, delta uint64) (uint64, error) {
+	return 0, ErrNotSupport
+}
+
+func (c *MemoryStore) Decrement(key string, delta uint64) (uint64, error) {
+	return 0, ErrNotSupport
+}
+
+func (c *MemoryStore) Flush() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = make(map[string]*list.Element)
+	c.lru.Init()
+	return nil
+}
@@ -0,0 +1,38 @@
+package cache
+
+import (
+	"fmt"
+	"time"
+)
+
+const scrapeExpire = 15 * time.Minute
+
+// Scrape is the number of seeds and peers of a torrent, as last scraped.
+type Scrape struct {
+	Seeds int64 `json:"seeds"`
+	Peers int64 `json:"peers"`
+}
+
+// ScrapeStore keeps the recent scrapes of torrents by info hash, so that
+// searches don't hit the trackers and the DHT again for the same torrents.
+type ScrapeStore struct {
+	store CacheStore
+}
+
+func NewScrapeStore(store CacheStore) *ScrapeStore {
+	return &ScrapeStore{store: store}
+}
+
+func scrapeKey(infoHash string) string {
+	return fmt.Sprintf("io.steeve.pulsar.scrape.%s", infoHash)
+}
+
+func (c *ScrapeStore) Get(infoHash string) (Scrape, error) {
+	var scrape Scrape
+	err := c.store.Get(scrapeKey(infoHash), &scrape)
+	return scrape, err
+}
+
+func (c *ScrapeStore) Set(infoHash string, scrape Scrape) error {
+	return c.store.Set(scrapeKey(infoHash), scrape, scrapeExpire)
+}
@@ -0,0 +1,91 @@
+package cache
+
+import (
+	"time"
+)
+
+// TieredStore layers a fast store, usually a MemoryStore, on top of a slower
+// but larger one, usually a FileStore. Writes go to both, and entries read
+// from the slow store are copied to the fast one.
+type TieredStore struct {
+	fast CacheStore
+	slow CacheStore
+
+	// how long entries copied to fast are kept when slow can't tell when
+	// they expire
+	promoteExpire time.Duration
+}
+
+func NewTieredStore(fast CacheStore, slow CacheStore, promoteExpire time.Duration) *TieredStore {
+	return &TieredStore{
+		fast:          fast,
+		slow:          slow,
+		promoteExpire: promoteExpire,
+	}
+}
+
+func (c *TieredStore) Get(key string, value interface{}) error {
+	if err := c.fast.Get(key, value); err == nil {
+		return nil
+	}
+	if fs, ok := c.slow.(*FileStore); ok {
+		expires, err := fs.get(key, value)
+		if err != nil {
+			return err
+		}
+		c.promote(key, value, expires)
+		return nil
+	}
+	if err := c.slow.Get(key, value); err != nil {
+		return err
+	}
+	c.promote(key, value, time.Now().UTC().Add(c.promoteExpire))
+	return nil
+}
+
+func (c *TieredStore) promote(key string, value interface{}, expires time.Time) {
+	if ms, ok := c.fast.(*MemoryStore); ok {
+		ms.set(key, value, expires)
+		return
+	}
+	c.fast.Set(key, value, expires.Sub(time.Now().UTC()))
+}
+
+func (c *TieredStore) Set(key string, value interface{}, expires time.Duration) error {
+	if err := c.slow.Set(key, value, expires); err != nil {
+		return err
+	}
+	return c.fast.Set(key, value, expires)
+}
+
+func (c *TieredStore) Add(key string, value interface{}, expires time.Duration) error {
+	if err := c.slow.Add(key, value, expires); err != nil {
+		return err
+	}
+	return c.fast.Set(key, value, expires)
+}
+
+func (c *TieredStore) Replace(key string, value interface{}, expires time.Duration) error {
+	if err := c.slow.Replace(key, value, expires); err != nil {
+		return err
+	}
+	return c.fast.Set(key, value, expires)
+}
+
+func (c *TieredStore) Delete(key string) error {
+	c.fast.Delete(key)
+	return c.slow.Delete(key)
+}
+
+func (c *TieredStore) Increment(key string, delta uint64) (uint64, error) {
+	return 0, ErrNotSupport
+}
+
+func (c *TieredStore) Decrement(key string, delta uint64) (uint64, error) {
+	return 0, ErrNotSupport
+}
+
+func (c *TieredStore) Flush() error {
+	c.fast.Flush()
+	return c.slow.Flush()
+}
@@ -26,6 +26,30 @@ type Configuration struct {
 	CustomProviderTimeoutEnabled bool
 	CustomProviderTimeout        int
 
+	DHTScrapeEnabled   bool
+	VerifyLinksEnabled bool
+
+	QualityPreferredResolution int
+	QualityMinResolution       int
+	QualityMaxResolution       int
+	QualityPreferredCodecs     []string
+	QualityBannedCodecs        []string
+	QualityMaxSizePerHour      int // in MB, per hour of runtime
+	QualityMinSeeds            int
+	QualityBannedGroups        []string
+	QualityBannedKeywords      []string
+
+	AudioLanguages []string
+
+	TorznabEndpoints []string
+
+	FeedURLs            []string
+	FeedAutoGrabEnabled bool
+	FeedFollowedShows   []string
+	FeedRefreshInterval int // in minutes
+
+	AnimeMappingFile string
+
 	SocksEnabled  bool
 	SocksHost     string
 	SocksPort     int
@@ -71,6 +95,30 @@ func Reload() *Configuration {
 		CustomProviderTimeoutEnabled: xbmc.GetSettingBool("custom_provider_timeout_enabled"),
 		CustomProviderTimeout:        xbmc.GetSettingInt("custom_provider_timeout"),
 
+		DHTScrapeEnabled:   xbmc.GetSettingBool("dht_scrape_enabled"),
+		VerifyLinksEnabled: xbmc.GetSettingBool("verify_links_enabled"),
+
+		QualityPreferredResolution: xbmc.GetSettingInt("quality_preferred_resolution"),
+		QualityMinResolution:       xbmc.GetSettingInt("quality_min_resolution"),
+		QualityMaxResolution:       xbmc.GetSettingInt("quality_max_resolution"),
+		QualityPreferredCodecs:     getSettingList("quality_preferred_codecs"),
+		QualityBannedCodecs:        getSettingList("quality_banned_codecs"),
+		QualityMaxSizePerHour:      xbmc.GetSettingInt("quality_max_size_per_hour"),
+		QualityMinSeeds:            xbmc.GetSettingInt("quality_min_seeds"),
+		QualityBannedGroups:        getSettingList("quality_banned_groups"),
+		QualityBannedKeywords:      getSettingList("quality_banned_keywords"),
+
+		AudioLanguages: getSettingList("audio_languages"),
+
+		TorznabEndpoints: splitSetting("torznab_endpoints"),
+
+		FeedURLs:            splitSetting("feed_urls"),
+		FeedAutoGrabEnabled: xbmc.GetSettingBool("feed_auto_grab_enabled"),
+		FeedFollowedShows:   getSettingList("feed_followed_shows"),
+		FeedRefreshInterval: xbmc.GetSettingInt("feed_refresh_interval"),
+
+		AnimeMappingFile: xbmc.GetSettingString("anime_mapping_file"),
+
 		SocksEnabled:  xbmc.GetSettingBool("socks_enabled"),
 		SocksHost:     xbmc.GetSettingString("socks_host"),
 		SocksPort:     xbmc.GetSettingInt("socks_port"),
@@ -84,6 +132,26 @@ func Reload() *Configuration {
 	return config
 }
 
+// getSettingList returns a comma separated setting as a lowercase list.
+func getSettingList(id string) []string {
+	list := splitSetting(id)
+	for i, item := range list {
+		list[i] = strings.ToLower(item)
+	}
+	return list
+}
+
+// splitSetting returns the items of a comma separated setting, as is.
+func splitSetting(id string) []string {
+	list := make([]string, 0)
+	for _, item := range strings.Split(xbmc.GetSettingString(id), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
 func AddonIcon() string {
 	return filepath.Join(Get().Info.Path, "icon.png")
 }
@@ -1,9 +1,18 @@
 package ga
 
-import "github.com/gin-gonic/gin"
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/steeve/pulsar/cache"
+)
 
+// GATracker tracks page views, except those of the requests Pulsar makes to
+// itself to refresh its cache.
 func GATracker() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
+		if ctx.Request.Header.Get(cache.RefreshHeader) != "" {
+			ctx.Next()
+			return
+		}
 		path := ctx.Request.URL.Path
 		query := ctx.Request.URL.RawQuery
 		if query != "" {
@@ -2,8 +2,10 @@ package main
 
 import (
 	"fmt"
+	"net"
 	"net/http"
 	"os"
+	"path"
 	"runtime"
 	"strconv"
 	"strings"
@@ -12,7 +14,9 @@ import (
 	"github.com/op/go-logging"
 	"github.com/steeve/pulsar/api"
 	"github.com/steeve/pulsar/bittorrent"
+	"github.com/steeve/pulsar/cache"
 	"github.com/steeve/pulsar/config"
+	"github.com/steeve/pulsar/providers"
 	"github.com/steeve/pulsar/util"
 	"github.com/steeve/pulsar/xbmc"
 )
@@ -28,6 +32,9 @@ ______  __ __|  |   ___________ _______
 |   __/|____/|____/____  >(____  /__|
 |__|                   \/      \/
 `
+
+	cacheJanitorInterval = 1 * time.Hour
+	cacheMaxSize         = 200 * 1024 * 1024 // 200MB
 )
 
 func ensureSingleInstance() {
@@ -99,6 +106,14 @@ func main() {
 	}
 	go watchParentProcess()
 
+	go cache.NewFileStore(path.Join(conf.ProfilePath, "cache")).RunJanitor(cacheJanitorInterval, cacheMaxSize)
+
+	providers.SetFilesResolver(btService.TorrentFiles)
+
+	go providers.WatchFeeds(func(torrent *bittorrent.Torrent) error {
+		return btService.AddTorrent(torrent.Magnet())
+	})
+
 	http.Handle("/", api.Routes(btService))
 	http.Handle("/files/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		handler := http.StripPrefix("/files/", http.FileServer(bittorrent.NewTorrentFS(btService, config.Get().DownloadPath)))
@@ -113,5 +128,12 @@ func main() {
 
 	xbmc.Notify("Pulsar", "Pulsar daemon has started", config.AddonIcon())
 
-	http.ListenAndServe(":"+strconv.Itoa(config.ListenPort), nil)
+	listener, err := net.Listen("tcp", ":"+strconv.Itoa(config.ListenPort))
+	if err != nil {
+		log.Error("Unable to listen on port %d: %s", config.ListenPort, err)
+		return
+	}
+	go api.WarmUpCache()
+
+	http.Serve(listener, nil)
 }
@@ -0,0 +1,213 @@
+package providers
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/steeve/pulsar/bittorrent"
+	"github.com/steeve/pulsar/config"
+	"github.com/steeve/pulsar/tmdb"
+	"github.com/steeve/pulsar/tvdb"
+)
+
+const (
+	defaultAnimeMappingFile = "xem.json"
+
+	// if >= 80% of episodes have absolute numbers, assume it's because we need it
+	mixAbsoluteNumberPercentage = 0.8
+)
+
+type episodeNumbering struct {
+	Season   int `json:"season"`
+	Episode  int `json:"episode"`
+	Absolute int `json:"absolute"`
+}
+
+// sceneMapping maps the TheTVDB numbering of an episode to the one used by
+// release groups, like the mappings of thexem.de. The mapping file is a JSON
+// object of the mappings of each show, keyed by TheTVDB id:
+//
+//	{"79824": [{"tvdb": {"season": 2, "episode": 1, "absolute": 33}, "scene": {"season": 1, "episode": 33, "absolute": 33}}]}
+type sceneMapping struct {
+	TVDB  episodeNumbering `json:"tvdb"`
+	Scene episodeNumbering `json:"scene"`
+}
+
+var (
+	sceneMappingsLock    = sync.Mutex{}
+	sceneMappings        map[string][]sceneMapping
+	sceneMappingsFile    string
+	sceneMappingsModTime time.Time
+)
+
+func animeMappingFile() string {
+	if file := config.Get().AnimeMappingFile; file != "" {
+		return file
+	}
+	return filepath.Join(config.Get().ProfilePath, defaultAnimeMappingFile)
+}
+
+// getSceneMappings returns the scene mappings of the local mapping file. The
+// file is read again whenever it changes.
+func getSceneMappings() map[string][]sceneMapping {
+	sceneMappingsLock.Lock()
+	defer sceneMappingsLock.Unlock()
+
+	file := animeMappingFile()
+	fi, err := os.Stat(file)
+	if err != nil {
+		sceneMappings = nil
+		sceneMappingsFile = ""
+		return nil
+	}
+	if file == sceneMappingsFile && fi.ModTime().Equal(sceneMappingsModTime) {
+		return sceneMappings
+	}
+
+	mappings := make(map[string][]sceneMapping)
+	data, err := ioutil.ReadFile(file)
+	if err == nil {
+		err = json.Unmarshal(data, &mappings)
+	}
+	if err != nil {
+		log.Error("Unable to load anime mappings from %s: %s\n", file, err)
+		mappings = nil
+	}
+	sceneMappings = mappings
+	sceneMappingsFile = file
+	sceneMappingsModTime = fi.ModTime()
+	return mappings
+}
+
+// getSceneNumbering returns how release groups number episode: from the
+// scene mappings if the show has some, like TheTVDB otherwise.
+func getSceneNumbering(show *tvdb.Show, episode *tvdb.Episode) episodeNumbering {
+	numbering := episodeNumbering{
+		Season:   episode.SeasonNumber,
+		Episode:  episode.EpisodeNumber,
+		Absolute: absoluteNumber(show, episode),
+	}
+	for _, mapping := range getSceneMappings()[strconv.Itoa(show.Id)] {
+		if mapping.TVDB.Season == numbering.Season && mapping.TVDB.Episode == numbering.Episode {
+			scene := mapping.Scene
+			if scene.Absolute == 0 {
+				scene.Absolute = numbering.Absolute
+			}
+			return scene
+		}
+	}
+	return numbering
+}
+
+// absoluteNumber returns the number of episode counted from the first episode
+// of the show. When TheTVDB doesn't know it, it's computed from the number of
+// episodes of the previous seasons. Specials have none.
+func absoluteNumber(show *tvdb.Show, episode *tvdb.Episode) int {
+	if episode.AbsoluteNumber > 0 {
+		return episode.AbsoluteNumber
+	}
+	if episode.SeasonNumber == 0 {
+		return 0
+	}
+	absolute := episode.EpisodeNumber
+	for _, season := range show.Seasons {
+		if season.Season > 0 && season.Season < episode.SeasonNumber {
+			absolute += len(season.Episodes)
+		}
+	}
+	return absolute
+}
+
+// episodeFromAbsolute is the reverse of absoluteNumber: it returns the
+// episode of show with that absolute number, or nil.
+func episodeFromAbsolute(show *tvdb.Show, absolute int) *tvdb.Episode {
+	for _, season := range show.Seasons {
+		if season.Season == 0 {
+			continue
+		}
+		for _, episode := range season.Episodes {
+			if absoluteNumber(show, episode) == absolute {
+				return episode
+			}
+		}
+	}
+	return nil
+}
+
+// isAnime guesses whether release groups number the episodes of show
+// absolutely.
+func isAnime(show *tvdb.Show, tmdbShow *tmdb.Show) bool {
+	if _, ok := getSceneMappings()[strconv.Itoa(show.Id)]; ok {
+		return true
+	}
+	if strings.Contains(strings.ToLower(show.Genre), "anime") {
+		return true
+	}
+	if tmdbShow != nil {
+		countryIsJP := false
+		for _, country := range tmdbShow.OriginCountry {
+			if country == "JP" {
+				countryIsJP = true
+				break
+			}
+		}
+		genreIsAnim := false
+		for _, genre := range tmdbShow.Genres {
+			if genre.Name == "Animation" {
+				genreIsAnim = true
+				break
+			}
+		}
+		if countryIsJP && genreIsAnim {
+			return true
+		}
+	}
+	if strings.Contains(show.Genre, "Animation") == false {
+		return false
+	}
+	// TheTVDB only bothers with absolute numbers for shows that need them
+	total := 0
+	numbered := 0
+	for _, season := range show.Seasons {
+		if season.Season == 0 {
+			continue
+		}
+		for _, episode := range season.Episodes {
+			total++
+			if episode.AbsoluteNumber > 0 {
+				numbered++
+			}
+		}
+	}
+	return total > 0 && float64(numbered)/float64(total) >= mixAbsoluteNumberPercentage
+}
+
+// episodeMatcher returns a function telling whether a release is exactly
+// episode, whether it's numbered like TheTVDB, like the scene or absolutely.
+// Batches and season packs don't match.
+func episodeMatcher(show *tvdb.Show, episode *tvdb.Episode, anime bool) func(info *bittorrent.ReleaseInfo) bool {
+	numbering := getSceneNumbering(show, episode)
+	return func(info *bittorrent.ReleaseInfo) bool {
+		if info.Batch || info.Complete {
+			return false
+		}
+		if len(info.Episodes) > 0 {
+			if info.HasEpisode(numbering.Season, numbering.Episode) || info.HasEpisode(episode.SeasonNumber, episode.EpisodeNumber) {
+				return true
+			}
+			// long running anime often keep counting in the first season,
+			// S01E500, while TheTVDB splits them
+			if anime && len(info.Episodes) == 1 && (len(info.Seasons) == 0 || containsInt(info.Seasons, 1)) {
+				return episodeFromAbsolute(show, info.Episodes[0]) == episode
+			}
+			return false
+		}
+		return anime && numbering.Absolute > 0 && info.HasAbsoluteEpisode(numbering.Absolute)
+	}
+}
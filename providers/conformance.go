@@ -0,0 +1,220 @@
+package providers
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/steeve/pulsar/bittorrent"
+	"github.com/steeve/pulsar/tmdb"
+	"github.com/steeve/pulsar/tvdb"
+)
+
+// well known movies and episodes that any general purpose provider should
+// find
+var (
+	conformanceMovies = []string{
+		"tt0133093", // The Matrix
+		"tt0816692", // Interstellar
+	}
+	conformanceEpisodes = []struct {
+		TVDBId  string
+		Season  int
+		Episode int
+	}{
+		{"81189", 1, 1},  // Breaking Bad
+		{"121361", 1, 1}, // Game of Thrones
+	}
+)
+
+// ConformanceFixture is a search to run against a provider, either for a
+// movie or for an episode.
+type ConformanceFixture struct {
+	Movie   *tmdb.Movie
+	Show    *tvdb.Show
+	Episode *tvdb.Episode
+}
+
+func (cf *ConformanceFixture) String() string {
+	if cf.Movie != nil {
+		return fmt.Sprintf("movie %s", cf.Movie.Title)
+	}
+	return fmt.Sprintf("episode %s %dx%02d", cf.Show.SeriesName, cf.Episode.SeasonNumber, cf.Episode.EpisodeNumber)
+}
+
+// ConformanceReport is the outcome of running a provider against fixtures.
+type ConformanceReport struct {
+	Provider string               `json:"provider"`
+	Passed   bool                 `json:"passed"`
+	Results  []*ConformanceResult `json:"results"`
+}
+
+// ConformanceResult is the outcome of a single fixture. Unsupported fixtures,
+// like episodes for a movies only provider, are skipped.
+type ConformanceResult struct {
+	Fixture   string   `json:"fixture"`
+	Skipped   bool     `json:"skipped,omitempty"`
+	Passed    bool     `json:"passed"`
+	LatencyMs int64    `json:"latency_ms"`
+	Results   int      `json:"results"`
+	Problems  []string `json:"problems,omitempty"`
+}
+
+// Err returns the problems of a report as an error, or nil if it passed.
+// It's meant for tests of providers:
+//
+//	if err := providers.RunConformance("fake", &fakeProvider{}, fixtures).Err(); err != nil {
+//		t.Fatal(err)
+//	}
+func (cr *ConformanceReport) Err() error {
+	if cr.Passed {
+		return nil
+	}
+	problems := make([]string, 0)
+	for _, result := range cr.Results {
+		for _, problem := range result.Problems {
+			problems = append(problems, fmt.Sprintf("%s: %s", result.Fixture, problem))
+		}
+	}
+	return errors.New(strings.Join(problems, "\n"))
+}
+
+// DefaultConformanceFixtures returns the built-in fixtures. Those that can't
+// be fetched from TMDB or TheTVDB are left out.
+func DefaultConformanceFixtures() []*ConformanceFixture {
+	fixtures := make([]*ConformanceFixture, 0, len(conformanceMovies)+len(conformanceEpisodes))
+	for _, imdbId := range conformanceMovies {
+		if movie := tmdb.GetMovieFromIMDB(imdbId, "en"); movie != nil {
+			fixtures = append(fixtures, &ConformanceFixture{Movie: movie})
+		}
+	}
+	for _, e := range conformanceEpisodes {
+		show, err := tvdb.NewShowCached(e.TVDBId, "en")
+		if err != nil || e.Season >= len(show.Seasons) || e.Episode > len(show.Seasons[e.Season].Episodes) {
+			continue
+		}
+		fixtures = append(fixtures, &ConformanceFixture{
+			Show:    show,
+			Episode: show.Seasons[e.Season].Episodes[e.Episode-1],
+		})
+	}
+	return fixtures
+}
+
+// RunConformance runs each fixture against provider, and checks that it
+// answers, that its results have an info hash and a valid URI, and that they
+// are releases of what was searched. Addon providers are checked before
+// their episode results are filtered.
+func RunConformance(name string, provider interface{}, fixtures []*ConformanceFixture) *ConformanceReport {
+	report := &ConformanceReport{
+		Provider: name,
+		Passed:   true,
+		Results:  make([]*ConformanceResult, 0, len(fixtures)),
+	}
+	for _, fixture := range fixtures {
+		result := runConformanceFixture(provider, fixture)
+		if result.Skipped == false && result.Passed == false {
+			report.Passed = false
+		}
+		report.Results = append(report.Results, result)
+	}
+	return report
+}
+
+func runConformanceFixture(provider interface{}, fixture *ConformanceFixture) *ConformanceResult {
+	result := &ConformanceResult{
+		Fixture:  fixture.String(),
+		Problems: make([]string, 0),
+	}
+
+	var search func() []*bittorrent.Torrent
+	var matches func(info *bittorrent.ReleaseInfo) string
+	if fixture.Movie != nil {
+		searcher, ok := provider.(MovieSearcher)
+		if ok == false {
+			result.Skipped = true
+			return result
+		}
+		search = func() []*bittorrent.Torrent {
+			return searcher.SearchMovieLinks(fixture.Movie)
+		}
+		titles := movieTitles(fixture.Movie)
+		year, _ := strconv.Atoi(strings.Split(fixture.Movie.ReleaseDate, "-")[0])
+		matches = func(info *bittorrent.ReleaseInfo) string {
+			return movieMismatch(info, titles, year)
+		}
+	} else {
+		searcher, ok := provider.(EpisodeSearcher)
+		if ok == false {
+			result.Skipped = true
+			return result
+		}
+		search = func() []*bittorrent.Torrent {
+			if as, ok := searcher.(*AddonSearcher); ok {
+				return as.call("search_episode", as.GetEpisodeSearchObject(fixture.Show, fixture.Episode))
+			}
+			return searcher.SearchEpisodeLinks(fixture.Show, fixture.Episode)
+		}
+		episodeMatches := episodeMatcher(fixture.Show, fixture.Episode, isAnime(fixture.Show, nil))
+		matches = func(info *bittorrent.ReleaseInfo) string {
+			if episodeMatches(info) == false {
+				return "is not the episode"
+			}
+			return ""
+		}
+	}
+
+	started := time.Now()
+	torrents := search()
+	result.LatencyMs = int64(time.Since(started) / time.Millisecond)
+	result.Results = len(torrents)
+	if len(torrents) == 0 {
+		result.Problems = append(result.Problems, "no results")
+	}
+	for _, torrent := range torrents {
+		for _, problem := range checkConformance(torrent, matches) {
+			result.Problems = append(result.Problems, fmt.Sprintf("%q %s", torrent.Name, problem))
+		}
+	}
+	result.Passed = len(result.Problems) == 0
+	return result
+}
+
+// checkConformance returns what's wrong with a search result.
+func checkConformance(torrent *bittorrent.Torrent, matches func(info *bittorrent.ReleaseInfo) string) []string {
+	problems := make([]string, 0)
+	if torrent.Name == "" && strings.HasPrefix(torrent.URI, "magnet:") == false {
+		problems = append(problems, "has no name")
+	}
+	u, err := url.Parse(torrent.URI)
+	switch {
+	case torrent.URI == "":
+		problems = append(problems, "has no URI")
+	case err != nil:
+		problems = append(problems, fmt.Sprintf("has an invalid URI: %s", err))
+	case u.Scheme == "magnet":
+		if strings.HasPrefix(u.Query().Get("xt"), "urn:btih:") == false {
+			problems = append(problems, "has a magnet without a BitTorrent info hash")
+		}
+	case u.Scheme != "http" && u.Scheme != "https":
+		problems = append(problems, fmt.Sprintf("has an unsupported URI scheme %q", u.Scheme))
+	}
+	if len(problems) > 0 {
+		return problems
+	}
+
+	torrent.Initialize()
+	if torrent.InfoHash == "" {
+		problems = append(problems, "has no info hash")
+	} else if hash, err := hex.DecodeString(torrent.InfoHash); err != nil || len(hash) != 20 {
+		problems = append(problems, fmt.Sprintf("has an invalid info hash %q", torrent.InfoHash))
+	}
+	if problem := matches(torrent.Release); problem != "" {
+		problems = append(problems, problem)
+	}
+	return problems
+}
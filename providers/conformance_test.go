@@ -0,0 +1,122 @@
+package providers
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/steeve/pulsar/bittorrent"
+	"github.com/steeve/pulsar/tmdb"
+	"github.com/steeve/pulsar/tvdb"
+)
+
+// fakeProvider answers searches with fixed results.
+type fakeProvider struct {
+	movies   []*bittorrent.Torrent
+	episodes []*bittorrent.Torrent
+}
+
+func (fp *fakeProvider) SearchMovieLinks(movie *tmdb.Movie) []*bittorrent.Torrent {
+	return fp.movies
+}
+
+func (fp *fakeProvider) SearchEpisodeLinks(show *tvdb.Show, episode *tvdb.Episode) []*bittorrent.Torrent {
+	return fp.episodes
+}
+
+// fakeMoviesProvider only searches movies.
+type fakeMoviesProvider struct {
+	movies []*bittorrent.Torrent
+}
+
+func (fp *fakeMoviesProvider) SearchMovieLinks(movie *tmdb.Movie) []*bittorrent.Torrent {
+	return fp.movies
+}
+
+func conformanceTestFixtures() []*ConformanceFixture {
+	movie := &tmdb.Movie{Entity: tmdb.Entity{Title: "The Matrix", OriginalTitle: "The Matrix", ReleaseDate: "1999-03-30"}}
+	episode := &tvdb.Episode{SeasonNumber: 1, EpisodeNumber: 2}
+	show := &tvdb.Show{
+		Id:         1,
+		SeriesName: "Show",
+		Seasons: tvdb.SeasonList{
+			{Season: 1, Episodes: tvdb.EpisodeList{{SeasonNumber: 1, EpisodeNumber: 1}, episode}},
+		},
+	}
+	return []*ConformanceFixture{
+		{Movie: movie},
+		{Show: show, Episode: episode},
+	}
+}
+
+func magnet(infoHash string, name string) *bittorrent.Torrent {
+	return &bittorrent.Torrent{URI: "magnet:?xt=urn:btih:" + infoHash + "&dn=" + name}
+}
+
+func TestRunConformance(t *testing.T) {
+	provider := &fakeProvider{
+		movies: []*bittorrent.Torrent{
+			magnet(strings.Repeat("01", 20), "The.Matrix.1999.1080p.BluRay.x264-GRP"),
+			magnet(strings.Repeat("02", 20), "Matrix.1999.720p.HDTV.x264"),
+		},
+		episodes: []*bittorrent.Torrent{
+			magnet(strings.Repeat("03", 20), "Show.S01E02.720p.HDTV.x264-GRP"),
+		},
+	}
+	report := RunConformance("fake", provider, conformanceTestFixtures())
+	if err := report.Err(); err != nil {
+		t.Fatal(err)
+	}
+	for _, result := range report.Results {
+		if result.Skipped || result.Results == 0 {
+			t.Errorf("%s: skipped or without results", result.Fixture)
+		}
+	}
+}
+
+func TestRunConformanceSkipsUnsupported(t *testing.T) {
+	provider := &fakeMoviesProvider{
+		movies: []*bittorrent.Torrent{magnet(strings.Repeat("01", 20), "The.Matrix.1999.1080p.BluRay.x264-GRP")},
+	}
+	report := RunConformance("fake", provider, conformanceTestFixtures())
+	if err := report.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if report.Results[1].Skipped == false {
+		t.Errorf("episode fixture of a movies only provider wasn't skipped")
+	}
+}
+
+func TestRunConformanceProblems(t *testing.T) {
+	provider := &fakeProvider{
+		movies: []*bittorrent.Torrent{
+			magnet(strings.Repeat("01", 20), "The.Matrix.Reloaded.2003.1080p.BluRay.x264-GRP"),
+			magnet("nothex", "The.Matrix.1999.1080p.BluRay.x264-GRP"),
+			{Name: "The.Matrix.1999.1080p.BluRay.x264-GRP", URI: "ftp://example.org/matrix.torrent"},
+			{Name: "The.Matrix.1999.1080p.BluRay.x264-GRP"},
+		},
+		episodes: []*bittorrent.Torrent{
+			magnet(strings.Repeat("03", 20), "Show.S01E03.720p.HDTV.x264-GRP"),
+		},
+	}
+	report := RunConformance("fake", provider, conformanceTestFixtures())
+	err := report.Err()
+	if err == nil {
+		t.Fatal("got no error")
+	}
+	for _, problem := range []string{
+		`"The.Matrix.Reloaded.2003.1080p.BluRay.x264-GRP" released in 2003 instead of 1999`,
+		"has an invalid info hash",
+		`has an unsupported URI scheme "ftp"`,
+		"has no URI",
+		"is not the episode",
+	} {
+		if strings.Contains(err.Error(), problem) == false {
+			t.Errorf("%q wasn't reported in:\n%s", problem, err)
+		}
+	}
+
+	empty := RunConformance("fake", &fakeProvider{}, conformanceTestFixtures())
+	if err := empty.Err(); err == nil || strings.Count(err.Error(), "no results") != 2 {
+		t.Errorf("got %v, want no results for both fixtures", err)
+	}
+}
@@ -0,0 +1,301 @@
+package providers
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/steeve/pulsar/bittorrent"
+	"github.com/steeve/pulsar/cache"
+	"github.com/steeve/pulsar/config"
+	"github.com/steeve/pulsar/tmdb"
+	"github.com/steeve/pulsar/tvdb"
+)
+
+const (
+	feedCacheTime              = 15 * time.Minute
+	defaultFeedRefreshInterval = 30 * time.Minute
+
+	feedGrabbedKey       = "io.steeve.pulsar.feeds.grabbed"
+	feedGrabbedCacheTime = 100 * 365 * 24 * time.Hour // 100 years
+)
+
+// Feed items can have their torrent metadata in several places, depending
+// on who generates the feed: RSS enclosures, the torrent namespace used by
+// ezRSS, or Torznab attributes.
+type feedItem struct {
+	Title string `xml:"title"`
+	Links []struct {
+		Href string `xml:"href,attr"`
+		Rel  string `xml:"rel,attr"`
+		Text string `xml:",chardata"`
+	} `xml:"link"`
+	Enclosure struct {
+		URL    string `xml:"url,attr"`
+		Length int64  `xml:"length,attr"`
+	} `xml:"enclosure"`
+	MagnetURI     string        `xml:"magnetURI"`
+	InfoHash      string        `xml:"infoHash"`
+	ContentLength int64         `xml:"contentLength"`
+	Seeds         int64         `xml:"seeds"`
+	Peers         int64         `xml:"peers"`
+	Attrs         []torznabAttr `xml:"attr"`
+}
+
+type feed struct {
+	Items   []feedItem `xml:"channel>item"` // RSS
+	Entries []feedItem `xml:"entry"`        // Atom
+}
+
+// FeedSearcher searches the items of the RSS/Atom feeds configured in the
+// settings. Feeds are fetched at most once per feedCacheTime.
+type FeedSearcher struct{}
+
+func init() {
+	Register("feeds", &FeedSearcher{})
+}
+
+func (fs *FeedSearcher) Configured() bool {
+	return len(config.Get().FeedURLs) > 0
+}
+
+func (fs *FeedSearcher) SearchLinks(query string) []*bittorrent.Torrent {
+	words := strings.Fields(NormalizeTitle(query))
+	return fs.filter(func(torrent *bittorrent.Torrent) bool {
+		name := NormalizeTitle(torrent.Name)
+		for _, word := range words {
+			if strings.Contains(name, word) == false {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+func (fs *FeedSearcher) SearchMovieLinks(movie *tmdb.Movie) []*bittorrent.Torrent {
+	title := NormalizeTitle(movie.Title)
+	year, _ := strconv.Atoi(strings.Split(movie.ReleaseDate, "-")[0])
+	return fs.filter(func(torrent *bittorrent.Torrent) bool {
+		if NormalizeTitle(torrent.Release.Title) != title {
+			return false
+		}
+		return year == 0 || torrent.Release.Year == 0 || torrent.Release.Year == year
+	})
+}
+
+func (fs *FeedSearcher) SearchEpisodeLinks(show *tvdb.Show, episode *tvdb.Episode) []*bittorrent.Torrent {
+	title := NormalizeTitle(show.SeriesName)
+	matches := episodeMatcher(show, episode, isAnime(show, nil))
+	return fs.filter(func(torrent *bittorrent.Torrent) bool {
+		return NormalizeTitle(torrent.Release.Title) == title && matches(torrent.Release)
+	})
+}
+
+func (fs *FeedSearcher) SearchSeasonLinks(show *tvdb.Show, season *tvdb.Season) []*bittorrent.Torrent {
+	title := NormalizeTitle(show.SeriesName)
+	return filterSeasonPacks(fs.filter(func(torrent *bittorrent.Torrent) bool {
+		return NormalizeTitle(torrent.Release.Title) == title
+	}), season.Season)
+}
+
+func (fs *FeedSearcher) filter(match func(torrent *bittorrent.Torrent) bool) []*bittorrent.Torrent {
+	torrents := make([]*bittorrent.Torrent, 0)
+	for _, torrent := range getFeedsItems(false) {
+		if match(torrent) {
+			torrents = append(torrents, torrent)
+		}
+	}
+	return torrents
+}
+
+func feedCacheKey(feedUrl string) string {
+	h := sha1.New()
+	io.WriteString(h, feedUrl)
+	return fmt.Sprintf("io.steeve.pulsar.feed.%s", hex.EncodeToString(h.Sum(nil)))
+}
+
+// getFeedsItems returns the items of all the configured feeds, from the cache
+// unless refresh is set.
+func getFeedsItems(refresh bool) []*bittorrent.Torrent {
+	cacheStore := cache.NewFileStore(path.Join(config.Get().ProfilePath, "cache"))
+	feedUrls := config.Get().FeedURLs
+
+	results := make(chan []*bittorrent.Torrent, len(feedUrls))
+	wg := sync.WaitGroup{}
+	for _, feedUrl := range feedUrls {
+		wg.Add(1)
+		go func(feedUrl string) {
+			defer wg.Done()
+			key := feedCacheKey(feedUrl)
+			var torrents []*bittorrent.Torrent
+			if refresh == false && cacheStore.Get(key, &torrents) == nil {
+				results <- torrents
+				return
+			}
+			torrents, err := fetchFeed(feedUrl)
+			if err != nil {
+				log.Error("Unable to fetch feed %s: %s\n", feedUrl, err)
+				return
+			}
+			cacheStore.Set(key, torrents, feedCacheTime)
+			results <- torrents
+		}(feedUrl)
+	}
+	wg.Wait()
+	close(results)
+
+	torrents := make([]*bittorrent.Torrent, 0)
+	for result := range results {
+		torrents = append(torrents, result...)
+	}
+	return torrents
+}
+
+func fetchFeed(feedUrl string) ([]*bittorrent.Torrent, error) {
+	client := &http.Client{Timeout: providerTimeout()}
+	resp, err := client.Get(feedUrl)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New(resp.Status)
+	}
+
+	f := feed{}
+	if err := xml.NewDecoder(resp.Body).Decode(&f); err != nil {
+		return nil, err
+	}
+	torrents := make([]*bittorrent.Torrent, 0, len(f.Items)+len(f.Entries))
+	for _, item := range append(f.Items, f.Entries...) {
+		if torrent := item.torrent(); torrent != nil {
+			torrents = append(torrents, torrent)
+		}
+	}
+	return torrents, nil
+}
+
+func (item *feedItem) torrent() *bittorrent.Torrent {
+	attrs := torznabAttrs(item.Attrs)
+
+	torrent := &bittorrent.Torrent{
+		URI:      item.MagnetURI,
+		InfoHash: strings.ToLower(item.InfoHash),
+		Name:     item.Title,
+		Size:     item.ContentLength,
+		Seeds:    item.Seeds,
+		Peers:    item.Peers,
+	}
+	if torrent.URI == "" {
+		torrent.URI = attrs["magneturl"]
+	}
+	if torrent.URI == "" {
+		torrent.URI = item.Enclosure.URL
+	}
+	if torrent.URI == "" {
+		torrent.URI = item.link()
+	}
+	if torrent.URI == "" {
+		return nil
+	}
+	if torrent.Size == 0 {
+		torrent.Size = item.Enclosure.Length
+	}
+	if torrent.InfoHash == "" {
+		torrent.InfoHash = strings.ToLower(attrs["infohash"])
+	}
+	if torrent.Seeds == 0 {
+		torrent.Seeds, _ = strconv.ParseInt(attrs["seeders"], 10, 64)
+	}
+	torrent.Initialize()
+	return torrent
+}
+
+// link returns the Atom enclosure link if any, or the first link.
+func (item *feedItem) link() string {
+	for _, link := range item.Links {
+		if link.Rel == "enclosure" && link.Href != "" {
+			return link.Href
+		}
+	}
+	for _, link := range item.Links {
+		if link.Href != "" {
+			return link.Href
+		}
+		if text := strings.TrimSpace(link.Text); text != "" {
+			return text
+		}
+	}
+	return ""
+}
+
+// WatchFeeds periodically refreshes the feeds and passes the new episodes of
+// the followed shows to grab, the best release of each episode according to
+// the quality profile. Episodes whose grab failed are retried on the next
+// refresh. It never returns.
+func WatchFeeds(grab func(torrent *bittorrent.Torrent) error) {
+	for {
+		conf := config.Get()
+		if conf.FeedAutoGrabEnabled && len(conf.FeedFollowedShows) > 0 {
+			grabFeedsItems(grab)
+		}
+		interval := defaultFeedRefreshInterval
+		if conf.FeedRefreshInterval > 0 {
+			interval = time.Duration(conf.FeedRefreshInterval) * time.Minute
+		}
+		time.Sleep(interval)
+	}
+}
+
+func feedEpisodeKey(title string, season int, episode int) string {
+	return fmt.Sprintf("%s s%02de%02d", title, season, episode)
+}
+
+func grabFeedsItems(grab func(torrent *bittorrent.Torrent) error) {
+	store := cache.NewFileStore(config.Get().ProfilePath)
+	grabbed := make(map[string]time.Time)
+	store.Get(feedGrabbedKey, &grabbed)
+
+	followed := make(map[string]bool)
+	for _, show := range config.Get().FeedFollowedShows {
+		followed[NormalizeTitle(show)] = true
+	}
+
+	profile := GetQualityProfile()
+	best := make(map[string]*bittorrent.Torrent)
+	for _, torrent := range getFeedsItems(true) {
+		title := NormalizeTitle(torrent.Release.Title)
+		if followed[title] == false || len(torrent.Release.Seasons) != 1 || len(torrent.Release.Episodes) != 1 {
+			continue
+		}
+		key := feedEpisodeKey(title, torrent.Release.Seasons[0], torrent.Release.Episodes[0])
+		if _, exists := grabbed[key]; exists || profile.Accepts(torrent, 0) == false {
+			continue
+		}
+		if current, exists := best[key]; exists == false || profile.Score(torrent) > profile.Score(current) {
+			best[key] = torrent
+		}
+	}
+	if len(best) == 0 {
+		return
+	}
+
+	for key, torrent := range best {
+		log.Info("Grabbing %s from feeds\n", torrent.Name)
+		if err := grab(torrent); err != nil {
+			log.Error("Unable to grab %s: %s", torrent.Name, err)
+			continue
+		}
+		grabbed[key] = time.Now()
+	}
+	store.Set(feedGrabbedKey, grabbed, feedGrabbedCacheTime)
+}
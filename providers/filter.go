@@ -0,0 +1,142 @@
+package providers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/steeve/pulsar/bittorrent"
+	"github.com/steeve/pulsar/tmdb"
+)
+
+const (
+	// release titles must be at least that similar to one of the titles of
+	// the movie
+	movieTitleMinSimilarity = 0.8
+	// release years are often those of the first screening
+	movieYearTolerance = 1
+)
+
+// DiscardedTorrent is a result filtered out of a search, and why.
+type DiscardedTorrent struct {
+	*bittorrent.Torrent
+	Reason string `json:"reason"`
+}
+
+// filterMovieLinks keeps the torrents whose release title and year match the
+// movie.
+func filterMovieLinks(movie *tmdb.Movie, torrents []*bittorrent.Torrent) ([]*bittorrent.Torrent, []*DiscardedTorrent) {
+	titles := movieTitles(movie)
+	year, _ := strconv.Atoi(strings.Split(movie.ReleaseDate, "-")[0])
+
+	kept := make([]*bittorrent.Torrent, 0, len(torrents))
+	discarded := make([]*DiscardedTorrent, 0)
+	for _, torrent := range torrents {
+		if reason := movieMismatch(bittorrent.ParseReleaseName(torrent.Name), titles, year); reason != "" {
+			discarded = append(discarded, &DiscardedTorrent{Torrent: torrent, Reason: reason})
+		} else {
+			kept = append(kept, torrent)
+		}
+	}
+	return kept, discarded
+}
+
+// movieLinksFilter returns the filter of the results of movie searches, for
+// processLinks and streamLinks.
+func movieLinksFilter(movie *tmdb.Movie) func(torrents []*bittorrent.Torrent) []*bittorrent.Torrent {
+	return func(torrents []*bittorrent.Torrent) []*bittorrent.Torrent {
+		kept, discarded := filterMovieLinks(movie, torrents)
+		if len(discarded) > 0 {
+			log.Info("Filtered %d irrelevant items\n", len(discarded))
+		}
+		return kept
+	}
+}
+
+// movieTitles returns the normalized titles a movie can be released under.
+func movieTitles(movie *tmdb.Movie) []string {
+	titles := []string{NormalizeTitle(movie.Title), NormalizeTitle(movie.OriginalTitle)}
+	if movie.AlternativeTitles != nil {
+		for _, title := range movie.AlternativeTitles.Titles {
+			titles = append(titles, NormalizeTitle(title.Title))
+		}
+	}
+	return titles
+}
+
+// movieMismatch returns why a release isn't the movie, or "" if it may be.
+// Releases whose title can't be parsed are given the benefit of the doubt.
+func movieMismatch(info *bittorrent.ReleaseInfo, titles []string, year int) string {
+	if len(info.Episodes) > 0 || len(info.Seasons) > 0 {
+		return "is an episode"
+	}
+	if year > 0 && info.Year > 0 && (info.Year < year-movieYearTolerance || info.Year > year+movieYearTolerance) {
+		return fmt.Sprintf("released in %d instead of %d", info.Year, year)
+	}
+	title := NormalizeTitle(info.Title)
+	if title == "" {
+		return ""
+	}
+	best := 0.0
+	for _, t := range titles {
+		if similarity := titleSimilarity(title, t); similarity > best {
+			best = similarity
+		}
+	}
+	if best < movieTitleMinSimilarity {
+		return fmt.Sprintf("title %q doesn't match (%.0f%% similar)", title, best*100)
+	}
+	return ""
+}
+
+// titleSimilarity returns how similar two normalized titles are, from 0 to 1,
+// based on their edit distance. Leading articles are often dropped by release
+// groups, so they are ignored.
+func titleSimilarity(a string, b string) float64 {
+	ra := []rune(withoutArticle(a))
+	rb := []rune(withoutArticle(b))
+	longest := len(ra)
+	if len(rb) > longest {
+		longest = len(rb)
+	}
+	if longest == 0 {
+		return 0
+	}
+	return 1 - float64(levenshtein(ra, rb))/float64(longest)
+}
+
+func withoutArticle(title string) string {
+	for _, article := range []string{"the ", "a ", "an "} {
+		if strings.HasPrefix(title, article) {
+			return title[len(article):]
+		}
+	}
+	return title
+}
+
+func levenshtein(a []rune, b []rune) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = minInt(previous[j]+1, minInt(current[j-1]+1, previous[j-1]+cost))
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
+
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
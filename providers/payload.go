@@ -1,16 +1,68 @@
 package providers
 
 import (
+	"bytes"
 	"encoding/base64"
 	"encoding/json"
+	"fmt"
+
+	"github.com/steeve/pulsar/bittorrent"
 )
 
+// ProtocolVersion is the version of the provider protocol. Version 1
+// providers post a bare JSON list of torrents to the callback URL, version 2
+// ones post a SearchResponse.
+const ProtocolVersion = 2
+
 type SearchPayload struct {
+	Version      int         `json:"version"`
 	Method       string      `json:"method"`
 	CallbackURL  string      `json:"callback_url"`
 	SearchObject interface{} `json:"search_object"`
 }
 
+// ProviderCapabilities are what a provider declares it can search for.
+type ProviderCapabilities struct {
+	Movie     bool     `json:"movie"`
+	Episode   bool     `json:"episode"`
+	Season    bool     `json:"season"`
+	Anime     bool     `json:"anime"`
+	Languages []string `json:"languages,omitempty"`
+}
+
+// ProviderError is how a provider reports why it couldn't search, such as
+// a site being down or a login failure.
+type ProviderError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (pe *ProviderError) Error() string {
+	return fmt.Sprintf("%s: %s", pe.Code, pe.Message)
+}
+
+type SearchResponse struct {
+	Version      int                   `json:"version"`
+	Results      []*bittorrent.Torrent `json:"results"`
+	Error        *ProviderError        `json:"error,omitempty"`
+	Capabilities *ProviderCapabilities `json:"capabilities,omitempty"`
+}
+
+// ParseSearchResponse decodes what a provider posted on its callback URL,
+// whichever protocol version it speaks.
+func ParseSearchResponse(body []byte) (*SearchResponse, error) {
+	response := &SearchResponse{}
+	if bytes.HasPrefix(bytes.TrimSpace(body), []byte("[")) {
+		response.Version = 1
+		err := json.Unmarshal(body, &response.Results)
+		return response, err
+	}
+	if err := json.Unmarshal(body, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
 type MovieSearchObject struct {
 	IMDBId string            `json:"imdb_id"`
 	Title  string            `json:"title"`
@@ -18,6 +70,9 @@ type MovieSearchObject struct {
 	Titles map[string]string `json:"titles"`
 }
 
+// Titles of shows are keyed by lowercase country code, like those of movies,
+// plus "original" for the original title. Languages are the translated
+// titles, keyed by language code.
 type EpisodeSearchObject struct {
 	IMDBId         string            `json:"imdb_id"`
 	TVDBId         int               `json:"tvdb_id"`
@@ -25,9 +80,20 @@ type EpisodeSearchObject struct {
 	Season         int               `json:"season"`
 	Episode        int               `json:"episode"`
 	Titles         map[string]string `json:"titles"`
+	Languages      map[string]string `json:"languages"`
 	AbsoluteNumber int               `json:"absolute_number"`
 }
 
+type SeasonSearchObject struct {
+	IMDBId       string            `json:"imdb_id"`
+	TVDBId       int               `json:"tvdb_id"`
+	Title        string            `json:"title"`
+	Season       int               `json:"season"`
+	EpisodeCount int               `json:"episode_count"`
+	Titles       map[string]string `json:"titles"`
+	Languages    map[string]string `json:"languages"`
+}
+
 func (sp *SearchPayload) String() string {
 	b, err := json.Marshal(sp)
 	if err != nil {
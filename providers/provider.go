@@ -17,3 +17,9 @@ type MovieSearcher interface {
 type EpisodeSearcher interface {
 	SearchEpisodeLinks(show *tvdb.Show, episode *tvdb.Episode) []*bittorrent.Torrent
 }
+
+// SeasonSearcher finds season packs, and complete series packs containing the
+// season.
+type SeasonSearcher interface {
+	SearchSeasonLinks(show *tvdb.Show, season *tvdb.Season) []*bittorrent.Torrent
+}
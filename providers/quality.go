@@ -0,0 +1,250 @@
+package providers
+
+import (
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/steeve/pulsar/bittorrent"
+	"github.com/steeve/pulsar/config"
+)
+
+const (
+	// score multiplier for each resolution step away from the preferred one
+	CoefResolutionDistance = 0.5
+	CoefPreferredCodec     = 1.5
+	CoefProper             = 1.1
+	CoefNuked              = 0.1
+	CoefPreferredLanguage  = 2.0
+	CoefOtherLanguage      = 0.3
+	CoefHardcodedSubtitles = 0.7
+)
+
+var codecAliases = map[string]int{
+	"xvid": bittorrent.CodecXVid,
+	"divx": bittorrent.CodecXVid,
+	"h264": bittorrent.CodecH264,
+	"x264": bittorrent.CodecH264,
+	"avc":  bittorrent.CodecH264,
+	"h265": bittorrent.CodecH265,
+	"x265": bittorrent.CodecH265,
+	"hevc": bittorrent.CodecH265,
+	"av1":  bittorrent.CodecAV1,
+}
+
+// QualityProfile decides which torrents are acceptable for playback, and
+// ranks them. Sizes are in bytes.
+type QualityProfile struct {
+	PreferredResolution int
+	MinResolution       int
+	MaxResolution       int
+	PreferredCodecs     []int
+	BannedCodecs        []int
+	MaxSizePerHour      int64
+	MinSeeds            int64
+	EnoughSeeds         int64 // a search can stop once a link has that many
+	BannedGroups        []string
+	BannedKeywords      []string
+	Languages           []string // preferred audio languages, ISO 639-1
+}
+
+// GetQualityProfile returns the device default profile, overridden by the
+// user settings.
+func GetQualityProfile() *QualityProfile {
+	conf := config.Get()
+	qp := defaultQualityProfile()
+
+	if conf.QualityPreferredResolution > bittorrent.ResolutionUnkown {
+		qp.PreferredResolution = conf.QualityPreferredResolution
+	}
+	if conf.QualityMinResolution > bittorrent.ResolutionUnkown {
+		qp.MinResolution = conf.QualityMinResolution
+	}
+	if conf.QualityMaxResolution > bittorrent.ResolutionUnkown {
+		qp.MaxResolution = conf.QualityMaxResolution
+	}
+	if len(conf.QualityPreferredCodecs) > 0 {
+		qp.PreferredCodecs = parseCodecs(conf.QualityPreferredCodecs)
+	}
+	if len(conf.QualityBannedCodecs) > 0 {
+		qp.BannedCodecs = parseCodecs(conf.QualityBannedCodecs)
+	}
+	if conf.QualityMaxSizePerHour > 0 {
+		qp.MaxSizePerHour = int64(conf.QualityMaxSizePerHour) * 1024 * 1024
+	}
+	qp.MinSeeds = int64(conf.QualityMinSeeds)
+	qp.BannedGroups = conf.QualityBannedGroups
+	qp.BannedKeywords = conf.QualityBannedKeywords
+	qp.Languages = conf.AudioLanguages
+	if len(qp.Languages) == 0 && conf.Language != "" {
+		qp.Languages = []string{conf.Language}
+	}
+
+	return qp
+}
+
+func parseCodecs(names []string) []int {
+	codecs := make([]int, 0, len(names))
+	for _, name := range names {
+		if codec, ok := codecAliases[strings.ToLower(name)]; ok {
+			codecs = append(codecs, codec)
+		}
+	}
+	return codecs
+}
+
+func containsInt(list []int, value int) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Accepts returns true if torrent can be played with this profile. runtime is
+// in minutes, 0 if unknown.
+func (qp *QualityProfile) Accepts(torrent *bittorrent.Torrent, runtime int) bool {
+	if torrent.Seeds < qp.MinSeeds {
+		return false
+	}
+	if torrent.Resolution > bittorrent.ResolutionUnkown {
+		if qp.MinResolution > bittorrent.ResolutionUnkown && torrent.Resolution < qp.MinResolution {
+			return false
+		}
+		if qp.MaxResolution > bittorrent.ResolutionUnkown && torrent.Resolution > qp.MaxResolution {
+			return false
+		}
+	}
+	if containsInt(qp.BannedCodecs, torrent.VideoCodec) {
+		return false
+	}
+	if qp.MaxSizePerHour > 0 && torrent.Size > 0 && runtime > 0 {
+		if torrent.Size*60/int64(runtime) > qp.MaxSizePerHour {
+			return false
+		}
+	}
+	if torrent.Release != nil && torrent.Release.Group != "" {
+		group := strings.ToLower(torrent.Release.Group)
+		for _, bannedGroup := range qp.BannedGroups {
+			if group == bannedGroup {
+				return false
+			}
+		}
+	}
+	lowerName := strings.ToLower(torrent.Name)
+	for _, keyword := range qp.BannedKeywords {
+		if strings.Contains(lowerName, keyword) {
+			return false
+		}
+	}
+	return true
+}
+
+// IsGoodEnough returns true if torrent is acceptable, at the preferred
+// resolution and well seeded, so that there is no point in waiting for more
+// results before playing it.
+func (qp *QualityProfile) IsGoodEnough(torrent *bittorrent.Torrent, runtime int) bool {
+	return qp.Accepts(torrent, runtime) &&
+		torrent.Seeds >= qp.EnoughSeeds &&
+		(qp.PreferredResolution == bittorrent.ResolutionUnkown || torrent.Resolution == qp.PreferredResolution)
+}
+
+// Score ranks acceptable torrents: the more seeds the better, with
+// diminishing returns, weighted by how close the torrent is to the
+// preferred resolution and codecs, and by the source quality.
+func (qp *QualityProfile) Score(torrent *bittorrent.Torrent) float64 {
+	score := math.Log10(float64(torrent.Seeds) + 1)
+
+	distance := 2 // unknown resolutions are treated as 2 steps away
+	if torrent.Resolution > bittorrent.ResolutionUnkown && qp.PreferredResolution > bittorrent.ResolutionUnkown {
+		distance = torrent.Resolution - qp.PreferredResolution
+		if distance < 0 {
+			distance = -distance
+		}
+	}
+	score *= math.Pow(CoefResolutionDistance, float64(distance))
+
+	if containsInt(qp.PreferredCodecs, torrent.VideoCodec) {
+		score *= CoefPreferredCodec
+	}
+	if torrent.RipType > bittorrent.RipUnknown {
+		score *= 1 + float64(torrent.RipType)/CoefRipType
+	}
+	score *= qp.languageCoef(torrent)
+	if torrent.Release != nil && torrent.Release.Hardcoded {
+		score *= CoefHardcodedSubtitles
+	}
+	switch torrent.SceneRating {
+	case bittorrent.RatingProper:
+		score *= CoefProper
+	case bittorrent.RatingNuked:
+		score *= CoefNuked
+	}
+	return score
+}
+
+// languageCoef favors torrents with one of the preferred audio languages.
+// Untagged torrents are usually in the original language, and are left
+// alone, like MULTI ones, while the ones explicitly in another language are
+// penalized unless they have subtitles in a preferred language.
+func (qp *QualityProfile) languageCoef(torrent *bittorrent.Torrent) float64 {
+	if len(qp.Languages) == 0 {
+		return 1
+	}
+	languages := torrent.Languages()
+	for _, language := range qp.Languages {
+		if containsString(languages, language) {
+			return CoefPreferredLanguage
+		}
+	}
+	if torrent.Release != nil {
+		for _, language := range qp.Languages {
+			if containsString(torrent.Release.Subtitles, language) {
+				return 1
+			}
+		}
+	}
+	if len(languages) > 0 && containsString(languages, bittorrent.LanguageMulti) == false {
+		return CoefOtherLanguage
+	}
+	return 1
+}
+
+// Select returns the torrents accepted by the profile, best first.
+func (qp *QualityProfile) Select(torrents []*bittorrent.Torrent, runtime int) []*bittorrent.Torrent {
+	selected := make([]*bittorrent.Torrent, 0, len(torrents))
+	for _, torrent := range torrents {
+		if qp.Accepts(torrent, runtime) {
+			selected = append(selected, torrent)
+		}
+	}
+	qp.Sort(selected)
+	return selected
+}
+
+// Sort sorts torrents best first, without discarding the ones the profile
+// doesn't accept.
+func (qp *QualityProfile) Sort(torrents []*bittorrent.Torrent) {
+	sort.Sort(sort.Reverse(byProfileScore{torrents, qp}))
+}
+
+type byProfileScore struct {
+	torrents []*bittorrent.Torrent
+	profile  *QualityProfile
+}
+
+func (a byProfileScore) Len() int      { return len(a.torrents) }
+func (a byProfileScore) Swap(i, j int) { a.torrents[i], a.torrents[j] = a.torrents[j], a.torrents[i] }
+func (a byProfileScore) Less(i, j int) bool {
+	return a.profile.Score(a.torrents[i]) < a.profile.Score(a.torrents[j])
+}
@@ -0,0 +1,14 @@
+// +build !arm
+
+package providers
+
+import "github.com/steeve/pulsar/bittorrent"
+
+func defaultQualityProfile() *QualityProfile {
+	return &QualityProfile{
+		PreferredResolution: bittorrent.Resolution1080p,
+		MaxResolution:       bittorrent.Resolution4k2k,
+		EnoughSeeds:         30,
+		BannedCodecs:        []int{},
+	}
+}
@@ -0,0 +1,16 @@
+// +build arm
+
+package providers
+
+import "github.com/steeve/pulsar/bittorrent"
+
+// ARM boxes can't decode anything above 1080p h264, and choke on remuxes.
+func defaultQualityProfile() *QualityProfile {
+	return &QualityProfile{
+		PreferredResolution: bittorrent.Resolution720p,
+		MaxResolution:       bittorrent.Resolution1080p,
+		EnoughSeeds:         15,
+		BannedCodecs:        []int{bittorrent.CodecH265, bittorrent.CodecAV1},
+		MaxSizePerHour:      4 * 1024 * 1024 * 1024,
+	}
+}
@@ -0,0 +1,78 @@
+package providers
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+var (
+	registryLock = sync.RWMutex{}
+	registry     = map[string]interface{}{}
+)
+
+// Register makes a native provider available to searches, alongside the
+// addon ones. provider must implement at least one of Searcher, MovieSearcher
+// or EpisodeSearcher. It is meant to be called from init functions, and
+// panics if name is already taken.
+func Register(name string, provider interface{}) {
+	switch provider.(type) {
+	case Searcher, MovieSearcher, EpisodeSearcher:
+	default:
+		panic(fmt.Sprintf("providers: %s doesn't implement any searcher interface", name))
+	}
+
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	if _, exists := registry[name]; exists {
+		panic(fmt.Sprintf("providers: Register called twice for %s", name))
+	}
+	registry[name] = provider
+}
+
+// ConfigurableProvider is implemented by the native providers that need
+// settings to work, e.g. URLs to query.
+type ConfigurableProvider interface {
+	// Configured returns false when the provider has nothing to search.
+	Configured() bool
+}
+
+// Registered returns the names of the native providers, minus the ones that
+// aren't configured.
+func Registered() []string {
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+	names := make([]string, 0, len(registry))
+	for _, name := range registeredNames() {
+		if cp, ok := registry[name].(ConfigurableProvider); ok && cp.Configured() == false {
+			continue
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// registeredNames must be called with registryLock held.
+func registeredNames() []string {
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func registeredSearcher(name string) interface{} {
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+	return registry[name]
+}
+
+// GetProvider returns the native provider registered as name, or else the
+// addon provider with that id.
+func GetProvider(name string) interface{} {
+	if provider := registeredSearcher(name); provider != nil {
+		return provider
+	}
+	return NewAddonSearcher(name)
+}
@@ -1,11 +1,15 @@
 package providers
 
 import (
+	"path"
 	"sort"
 	"sync"
+	"time"
 
 	"github.com/op/go-logging"
 	"github.com/steeve/pulsar/bittorrent"
+	"github.com/steeve/pulsar/cache"
+	"github.com/steeve/pulsar/config"
 	"github.com/steeve/pulsar/tmdb"
 	"github.com/steeve/pulsar/tvdb"
 )
@@ -22,6 +26,12 @@ var DefaultTrackers = []string{
 	"udp://pow7.com:80/announce",
 }
 
+const (
+	dhtScrapeTimeout = 5 * time.Second
+	// each DHT lookup has its own socket
+	dhtScrapeConcurrency = 8
+)
+
 var log = logging.MustGetLogger("linkssearch")
 
 func Search(searchers []Searcher, query string) []*bittorrent.Torrent {
@@ -41,7 +51,7 @@ func Search(searchers []Searcher, query string) []*bittorrent.Torrent {
 		close(torrentsChan)
 	}()
 
-	return processLinks(torrentsChan)
+	return processLinks(torrentsChan, 0, nil)
 }
 
 func SearchMovie(searchers []MovieSearcher, movie *tmdb.Movie) []*bittorrent.Torrent {
@@ -61,7 +71,7 @@ func SearchMovie(searchers []MovieSearcher, movie *tmdb.Movie) []*bittorrent.Tor
 		close(torrentsChan)
 	}()
 
-	return processLinks(torrentsChan)
+	return processLinks(torrentsChan, movie.Runtime, movieLinksFilter(movie))
 }
 
 func SearchEpisode(searchers []EpisodeSearcher, show *tvdb.Show, episode *tvdb.Episode) []*bittorrent.Torrent {
@@ -81,19 +91,70 @@ func SearchEpisode(searchers []EpisodeSearcher, show *tvdb.Show, episode *tvdb.E
 		close(torrentsChan)
 	}()
 
-	return processLinks(torrentsChan)
+	return processLinks(torrentsChan, show.Runtime, nil)
 }
 
-func processLinks(torrentsChan chan *bittorrent.Torrent) []*bittorrent.Torrent {
-	trackers := map[string]*bittorrent.Tracker{}
-	torrentsMap := map[string]*bittorrent.Torrent{}
+// SearchSeason returns the packs containing a whole season. Runtime isn't
+// passed on since packs can't be filtered by size.
+func SearchSeason(searchers []SeasonSearcher, show *tvdb.Show, season *tvdb.Season) []*bittorrent.Torrent {
+	torrentsChan := make(chan *bittorrent.Torrent)
+	go func() {
+		wg := sync.WaitGroup{}
+		for _, searcher := range searchers {
+			wg.Add(1)
+			go func(searcher SeasonSearcher) {
+				defer wg.Done()
+				for _, torrent := range searcher.SearchSeasonLinks(show, season) {
+					torrentsChan <- torrent
+				}
+			}(searcher)
+		}
+		wg.Wait()
+		close(torrentsChan)
+	}()
+
+	return processLinks(torrentsChan, 0, nil)
+}
+
+// filterSeasonPacks keeps the torrents containing the whole season, either
+// season packs or complete series.
+func filterSeasonPacks(torrents []*bittorrent.Torrent, season int) []*bittorrent.Torrent {
+	packs := make([]*bittorrent.Torrent, 0, len(torrents))
+	for _, torrent := range torrents {
+		if len(torrent.Release.Episodes) > 0 {
+			continue
+		}
+		if containsInt(torrent.Release.Seasons, season) || (len(torrent.Release.Seasons) == 0 && torrent.Release.Complete) {
+			packs = append(packs, torrent)
+		}
+	}
+	if len(packs) < len(torrents) {
+		log.Info("Filtered %d items that are not season packs", len(torrents)-len(packs))
+	}
+	return packs
+}
 
+// processLinks resolves, filters, deduplicates, scrapes and sorts torrents.
+// runtime is the duration in minutes of the movie or episode, 0 if unknown.
+// filter, if not nil, drops the irrelevant torrents once they're resolved.
+func processLinks(torrentsChan chan *bittorrent.Torrent, runtime int, filter func(torrents []*bittorrent.Torrent) []*bittorrent.Torrent) []*bittorrent.Torrent {
 	torrents := make([]*bittorrent.Torrent, 0)
+	for torrent := range torrentsChan {
+		torrents = append(torrents, torrent)
+	}
+	torrents = resolveTorrents(torrents)
+	if filter != nil {
+		torrents = filter(torrents)
+	}
+	return rankTorrents(mergeTorrents(torrents), runtime)
+}
 
+// resolveTorrents fetches the .torrent files of torrents to find their info
+// hashes and trackers.
+func resolveTorrents(torrents []*bittorrent.Torrent) []*bittorrent.Torrent {
 	log.Info("Resolving torrent files...")
 	wg := sync.WaitGroup{}
-	for torrent := range torrentsChan {
-		torrents = append(torrents, torrent)
+	for _, torrent := range torrents {
 		wg.Add(1)
 		go func(torrent *bittorrent.Torrent) {
 			defer wg.Done()
@@ -103,7 +164,14 @@ func processLinks(torrentsChan chan *bittorrent.Torrent) []*bittorrent.Torrent {
 		}(torrent)
 	}
 	wg.Wait()
+	return torrents
+}
 
+// mergeTorrents merges the torrents sharing the same info hash, keeping the
+// best of what each provider knew about them.
+func mergeTorrents(torrents []*bittorrent.Torrent) []*bittorrent.Torrent {
+	torrentsMap := map[string]*bittorrent.Torrent{}
+	merged := make([]*bittorrent.Torrent, 0, len(torrents))
 	for _, torrent := range torrents {
 		if torrent.InfoHash == "" { // ignore torrents whose infohash is empty
 			log.Error("Infohash is empty for %s\n", torrent.URI)
@@ -128,49 +196,143 @@ func processLinks(torrentsChan chan *bittorrent.Torrent) []*bittorrent.Torrent {
 			}
 		} else {
 			torrentsMap[torrent.InfoHash] = torrent
+			merged = append(merged, torrent)
+		}
+	}
+	return merged
+}
+
+// rankTorrents filters, scrapes and sorts deduplicated torrents.
+func rankTorrents(torrents []*bittorrent.Torrent, runtime int) []*bittorrent.Torrent {
+	log.Info("Received %d links.\n", len(torrents))
+
+	if len(torrents) == 0 {
+		return torrents
+	}
+
+	if runtime > 0 {
+		torrents = filterBySize(torrents, runtime)
+	}
+
+	if uncachedTorrents := getCachedScrapes(torrents); len(uncachedTorrents) > 0 {
+		scrapeTorrents(getTrackers(uncachedTorrents), uncachedTorrents)
+		setCachedScrapes(uncachedTorrents)
+	}
+
+	sort.Sort(sort.Reverse(BySeeds(torrents)))
+
+	if config.Get().VerifyLinksEnabled {
+		torrents = verifyTorrents(torrents)
+	}
+
+	log.Info("Sorted torrent candidates:\n")
+	for _, torrent := range torrents {
+		log.Info("%s S:%d P:%d", torrent.Name, torrent.Seeds, torrent.Peers)
+	}
+
+	return torrents
+}
+
+func scrapeStore() *cache.ScrapeStore {
+	return cache.NewScrapeStore(cache.NewFileStore(path.Join(config.Get().ProfilePath, "cache")))
+}
+
+// getCachedScrapes fills torrents with the recently scraped seeds and peers,
+// and returns the ones that still need to be scraped.
+func getCachedScrapes(torrents []*bittorrent.Torrent) []*bittorrent.Torrent {
+	store := scrapeStore()
+	uncached := make([]*bittorrent.Torrent, 0, len(torrents))
+	for _, torrent := range torrents {
+		scrape, err := store.Get(torrent.InfoHash)
+		if err != nil {
+			uncached = append(uncached, torrent)
+			continue
+		}
+		if scrape.Seeds > torrent.Seeds {
+			torrent.Seeds = scrape.Seeds
+		}
+		if scrape.Peers > torrent.Peers {
+			torrent.Peers = scrape.Peers
+		}
+	}
+	if cachedCount := len(torrents) - len(uncached); cachedCount > 0 {
+		log.Info("Using cached metrics for %d torrents\n", cachedCount)
+	}
+	return uncached
+}
+
+// setCachedScrapes caches the scraped metrics. Torrents nobody knew about are
+// not cached so that they can be retried on the next search.
+func setCachedScrapes(torrents []*bittorrent.Torrent) {
+	store := scrapeStore()
+	for _, torrent := range torrents {
+		if torrent.Seeds == 0 && torrent.Peers == 0 {
+			continue
 		}
+		store.Set(torrent.InfoHash, cache.Scrape{Seeds: torrent.Seeds, Peers: torrent.Peers})
+	}
+}
+
+// getTrackers returns the trackers of torrents and the default ones, minus
+// the dead ones.
+func getTrackers(torrents []*bittorrent.Torrent) map[string]bittorrent.Scraper {
+	trackers := map[string]bittorrent.Scraper{}
+	for _, torrent := range torrents {
 		for _, tracker := range torrent.Trackers {
-			bTracker, err := bittorrent.NewTracker(tracker)
+			scraper, err := bittorrent.NewScraper(tracker)
 			if err != nil {
 				continue
 			}
-			trackers[bTracker.URL.Host] = bTracker
+			trackers[scraper.String()] = scraper
 		}
 	}
 
 	for _, trackerUrl := range DefaultTrackers {
-		tracker, _ := bittorrent.NewTracker(trackerUrl)
-		trackers[tracker.URL.Host] = tracker
-	}
-
-	torrents = make([]*bittorrent.Torrent, 0, len(torrentsMap))
-	for _, torrent := range torrentsMap {
-		torrents = append(torrents, torrent)
+		tracker, err := bittorrent.NewScraper(trackerUrl)
+		if err != nil {
+			continue
+		}
+		trackers[tracker.String()] = tracker
 	}
 
-	log.Info("Received %d links.\n", len(torrents))
-
-	if len(torrents) == 0 {
-		return torrents
+	for trackerUrl := range trackers {
+		if isTrackerDead(trackerUrl) {
+			log.Info("Skipping dead tracker %s\n", trackerUrl)
+			delete(trackers, trackerUrl)
+		}
 	}
+	return trackers
+}
 
+// scrapeTorrents fetches the seeds and peers of torrents from trackers, and
+// from the DHT if enabled.
+func scrapeTorrents(trackers map[string]bittorrent.Scraper, torrents []*bittorrent.Torrent) {
 	log.Info("Scraping torrent metrics from %d trackers...\n", len(trackers))
 	scrapeResults := make(chan []bittorrent.ScrapeResponseEntry)
 	go func() {
 		wg := sync.WaitGroup{}
 		for _, tracker := range trackers {
 			wg.Add(1)
-			go func(tracker *bittorrent.Tracker) {
+			go func(tracker bittorrent.Scraper) {
 				defer wg.Done()
+				defer tracker.Close()
+				started := time.Now()
 				if err := tracker.Connect(); err != nil {
 					log.Info("Tracker %s is not available because: %s\n", tracker, err)
+					recordTrackerResult(tracker.String(), time.Since(started), err)
 					return
 				}
-				scrapeResults <- tracker.Scrape(torrents)
+				results, err := tracker.Scrape(torrents)
+				if err != nil {
+					log.Info("Tracker %s returned partial results: %s\n", tracker, err)
+				}
+				recordTrackerResult(tracker.String(), time.Since(started), err)
+				scrapeResults <- results
 			}(tracker)
 		}
 		wg.Wait()
 		close(scrapeResults)
+		saveTrackersHealth()
 	}()
 
 	for results := range scrapeResults {
@@ -184,11 +346,38 @@ func processLinks(torrentsChan chan *bittorrent.Torrent) []*bittorrent.Torrent {
 		}
 	}
 
-	sort.Sort(sort.Reverse(BySeeds(torrents)))
-	log.Info("Sorted torrent candidates:\n")
-	for _, torrent := range torrents {
-		log.Info("%s S:%d P:%d", torrent.Name, torrent.Seeds, torrent.Peers)
+	if config.Get().DHTScrapeEnabled {
+		estimateSwarmsFromDHT(torrents)
 	}
+}
 
-	return torrents
+// estimateSwarmsFromDHT fills the seeds and peers of the public torrents no
+// tracker knew about with the DHT swarm size estimation, at most
+// dhtScrapeConcurrency at a time.
+func estimateSwarmsFromDHT(torrents []*bittorrent.Torrent) {
+	wg := sync.WaitGroup{}
+	slots := make(chan struct{}, dhtScrapeConcurrency)
+	for _, torrent := range torrents {
+		if torrent.Seeds > 0 || torrent.IsPrivate {
+			continue
+		}
+		wg.Add(1)
+		go func(torrent *bittorrent.Torrent) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			result, err := bittorrent.DHTScrape(torrent.InfoHash, dhtScrapeTimeout)
+			if err != nil {
+				log.Info("Unable to scrape %s from DHT: %s\n", torrent.InfoHash, err)
+				return
+			}
+			if result.Seeds > torrent.Seeds {
+				torrent.Seeds = result.Seeds
+			}
+			if result.Peers > torrent.Peers {
+				torrent.Peers = result.Peers
+			}
+		}(torrent)
+	}
+	wg.Wait()
 }
@@ -0,0 +1,51 @@
+package providers
+
+import (
+	"github.com/steeve/pulsar/bittorrent"
+)
+
+// Bitrate bounds in bits per second, indexed by resolution. Torrents below the
+// minimum are most likely fakes, above the maximum they are remuxes or worse.
+var (
+	minBitrates = []int64{200e3, 300e3, 700e3, 1500e3, 3000e3, 5000e3}
+	maxBitrates = []int64{20e6, 4e6, 10e6, 20e6, 30e6, 50e6}
+)
+
+// episodeCount returns how many episodes (or movies) the torrent contains,
+// 0 if that can't be known, like for season packs.
+func episodeCount(torrent *bittorrent.Torrent) int {
+	if torrent.Release == nil || len(torrent.Release.Episodes) == 0 {
+		if torrent.Release != nil && (len(torrent.Release.Seasons) > 0 || torrent.Release.Complete) {
+			return 0
+		}
+		return 1
+	}
+	return len(torrent.Release.Episodes)
+}
+
+// filterBySize computes the implied bitrate of torrents from their size and
+// runtime (in minutes), discards the ones too small to be what they claim,
+// and flags the oversized ones.
+func filterBySize(torrents []*bittorrent.Torrent, runtime int) []*bittorrent.Torrent {
+	filtered := make([]*bittorrent.Torrent, 0, len(torrents))
+	for _, torrent := range torrents {
+		count := episodeCount(torrent)
+		if torrent.Size <= 0 || count == 0 || torrent.Resolution >= len(minBitrates) {
+			filtered = append(filtered, torrent)
+			continue
+		}
+		torrent.Bitrate = torrent.Size * 8 / int64(runtime*60*count)
+		if torrent.Bitrate < minBitrates[torrent.Resolution] {
+			log.Info("Discarding %s, bitrate of %d kbps is too low\n", torrent.Name, torrent.Bitrate/1000)
+			continue
+		}
+		if torrent.Bitrate > maxBitrates[torrent.Resolution] {
+			torrent.IsOversized = true
+		}
+		filtered = append(filtered, torrent)
+	}
+	if len(filtered) < len(torrents) {
+		log.Info("Filtered %d fake items", len(torrents)-len(filtered))
+	}
+	return filtered
+}
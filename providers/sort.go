@@ -12,11 +12,18 @@ func (a ByResolution) Len() int           { return len(a) }
 func (a ByResolution) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
 func (a ByResolution) Less(i, j int) bool { return a[i].Resolution < a[j].Resolution }
 
+// BySeeds sorts by seeds, then by peers, as that's all the DHT can tell
+// about swarms when nodes don't support BEP 33.
 type BySeeds []*bittorrent.Torrent
 
-func (a BySeeds) Len() int           { return len(a) }
-func (a BySeeds) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
-func (a BySeeds) Less(i, j int) bool { return a[i].Seeds < a[j].Seeds }
+func (a BySeeds) Len() int      { return len(a) }
+func (a BySeeds) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a BySeeds) Less(i, j int) bool {
+	if a[i].Seeds != a[j].Seeds {
+		return a[i].Seeds < a[j].Seeds
+	}
+	return a[i].Peers < a[j].Peers
+}
 
 const (
 	CoefRipType = 10.0
@@ -0,0 +1,230 @@
+package providers
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/steeve/pulsar/cache"
+	"github.com/steeve/pulsar/config"
+)
+
+const (
+	providersStatsKey       = "io.steeve.pulsar.providers"
+	providersStatsCacheTime = 100 * 365 * 24 * time.Hour // 100 years
+
+	// weight of the last sample in the moving averages
+	providerStatsSmoothing = 0.3
+	// results are saved at most that often
+	providersStatsSaveDelay = 10 * time.Second
+)
+
+// ProviderStats are the rolling statistics and user settings of a provider.
+type ProviderStats struct {
+	Name             string    `json:"name"`
+	Disabled         bool      `json:"disabled"`
+	Timeout          int       `json:"timeout"` // in seconds, 0 for the default
+	Searches         int       `json:"searches"`
+	Failures         int       `json:"failures"`
+	AverageLatencyMs int64     `json:"average_latency_ms"`
+	AverageResults   float64   `json:"average_results"`
+	LastError        string    `json:"last_error,omitempty"`
+	LastSearch       time.Time `json:"last_search"`
+
+	Capabilities *ProviderCapabilities `json:"capabilities,omitempty"`
+}
+
+var (
+	providersStatsLock = sync.RWMutex{}
+	providersStats     map[string]*ProviderStats
+	// a save is scheduled
+	providersStatsDirty bool
+
+	// serializes the writes of the stats, which happen without
+	// providersStatsLock
+	providersStatsSaveLock = sync.Mutex{}
+)
+
+func (ps *ProviderStats) FailureRate() float64 {
+	if ps.Searches == 0 {
+		return 0
+	}
+	return float64(ps.Failures) / float64(ps.Searches)
+}
+
+func providersStatsStore() cache.CacheStore {
+	return cache.NewFileStore(config.Get().ProfilePath)
+}
+
+// must be called with providersStatsLock held
+func loadProvidersStats() {
+	if providersStats != nil {
+		return
+	}
+	providersStats = make(map[string]*ProviderStats)
+	if err := providersStatsStore().Get(providersStatsKey, &providersStats); err != nil {
+		providersStats = make(map[string]*ProviderStats)
+	}
+}
+
+// must be called with providersStatsLock held
+func getProviderStats(name string) *ProviderStats {
+	loadProvidersStats()
+	ps, ok := providersStats[name]
+	if !ok {
+		ps = &ProviderStats{Name: name}
+		providersStats[name] = ps
+	}
+	return ps
+}
+
+// scheduleProvidersStatsSave saves the stats in a while, so that searches
+// don't wait on the disk. Must be called with providersStatsLock held.
+func scheduleProvidersStatsSave() {
+	if providersStatsDirty {
+		return
+	}
+	providersStatsDirty = true
+	time.AfterFunc(providersStatsSaveDelay, saveProvidersStats)
+}
+
+// saveProvidersStats writes a copy of the stats. Must be called without
+// providersStatsLock held.
+func saveProvidersStats() {
+	providersStatsSaveLock.Lock()
+	defer providersStatsSaveLock.Unlock()
+
+	providersStatsLock.Lock()
+	providersStatsDirty = false
+	stats := make(map[string]*ProviderStats, len(providersStats))
+	for name, ps := range providersStats {
+		psCopy := *ps
+		stats[name] = &psCopy
+	}
+	providersStatsLock.Unlock()
+
+	if err := providersStatsStore().Set(providersStatsKey, stats, providersStatsCacheTime); err != nil {
+		log.Error("Unable to save providers stats: %s", err)
+	}
+}
+
+func recordProviderResult(name string, latency time.Duration, results int, err error) {
+	providersStatsLock.Lock()
+	defer providersStatsLock.Unlock()
+
+	ps := getProviderStats(name)
+	ps.LastSearch = time.Now()
+	ps.Searches++
+	if err != nil {
+		ps.Failures++
+		ps.LastError = err.Error()
+		scheduleProvidersStatsSave()
+		return
+	}
+	latencyMs := int64(latency / time.Millisecond)
+	if ps.Searches-ps.Failures == 1 {
+		ps.AverageLatencyMs = latencyMs
+		ps.AverageResults = float64(results)
+	} else {
+		ps.AverageLatencyMs = int64(providerStatsSmoothing*float64(latencyMs) + (1-providerStatsSmoothing)*float64(ps.AverageLatencyMs))
+		ps.AverageResults = providerStatsSmoothing*float64(results) + (1-providerStatsSmoothing)*ps.AverageResults
+	}
+	scheduleProvidersStatsSave()
+}
+
+// providerSearchTimeout returns how long to wait for the results of a
+// provider: its own timeout if set, the custom one of the settings otherwise.
+func providerSearchTimeout(name string) time.Duration {
+	timeout := providerTimeout()
+	conf := config.Get()
+	if conf.CustomProviderTimeoutEnabled == true {
+		timeout = time.Duration(conf.CustomProviderTimeout) * time.Second
+	}
+	if stats := GetProviderStats(name); stats.Timeout > 0 {
+		timeout = time.Duration(stats.Timeout) * time.Second
+	}
+	return timeout
+}
+
+func IsProviderEnabled(name string) bool {
+	providersStatsLock.Lock()
+	defer providersStatsLock.Unlock()
+	loadProvidersStats()
+	if ps, ok := providersStats[name]; ok {
+		return ps.Disabled == false
+	}
+	return true
+}
+
+func SetProviderEnabled(name string, enabled bool) {
+	providersStatsLock.Lock()
+	getProviderStats(name).Disabled = enabled == false
+	providersStatsLock.Unlock()
+	saveProvidersStats()
+}
+
+// SetProviderTimeout overrides the search timeout of a provider, in seconds.
+// 0 restores the default.
+func SetProviderTimeout(name string, timeout int) {
+	providersStatsLock.Lock()
+	getProviderStats(name).Timeout = timeout
+	providersStatsLock.Unlock()
+	saveProvidersStats()
+}
+
+func setProviderCapabilities(name string, capabilities *ProviderCapabilities) {
+	providersStatsLock.Lock()
+	defer providersStatsLock.Unlock()
+	getProviderStats(name).Capabilities = capabilities
+	scheduleProvidersStatsSave()
+}
+
+// ResetProviderStats forgets the statistics of a provider, but not its
+// settings.
+func ResetProviderStats(name string) {
+	providersStatsLock.Lock()
+	ps := getProviderStats(name)
+	providersStats[name] = &ProviderStats{
+		Name:         name,
+		Disabled:     ps.Disabled,
+		Timeout:      ps.Timeout,
+		Capabilities: ps.Capabilities,
+	}
+	providersStatsLock.Unlock()
+	saveProvidersStats()
+}
+
+// GetProviderStats returns a copy of the stats of a provider, empty ones if
+// it's unknown.
+func GetProviderStats(name string) *ProviderStats {
+	providersStatsLock.Lock()
+	defer providersStatsLock.Unlock()
+	loadProvidersStats()
+	if ps, ok := providersStats[name]; ok {
+		psCopy := *ps
+		return &psCopy
+	}
+	return &ProviderStats{Name: name}
+}
+
+// GetProvidersStats returns a copy of the stats of all the known providers,
+// sorted by name.
+func GetProvidersStats() []*ProviderStats {
+	providersStatsLock.Lock()
+	defer providersStatsLock.Unlock()
+	loadProvidersStats()
+
+	list := make([]*ProviderStats, 0, len(providersStats))
+	for _, ps := range providersStats {
+		psCopy := *ps
+		list = append(list, &psCopy)
+	}
+	sort.Sort(ByProviderName(list))
+	return list
+}
+
+type ByProviderName []*ProviderStats
+
+func (a ByProviderName) Len() int           { return len(a) }
+func (a ByProviderName) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a ByProviderName) Less(i, j int) bool { return a[i].Name < a[j].Name }
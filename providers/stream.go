@@ -0,0 +1,102 @@
+package providers
+
+import (
+	"sync"
+
+	"github.com/steeve/pulsar/bittorrent"
+	"github.com/steeve/pulsar/tmdb"
+	"github.com/steeve/pulsar/tvdb"
+)
+
+// SearchStream delivers the results of a search provider by provider, as
+// soon as each of them is ranked, instead of waiting for the slowest one.
+type SearchStream struct {
+	// Results is closed once all the providers answered, or the stream was
+	// closed.
+	Results <-chan []*bittorrent.Torrent
+
+	closing   chan struct{}
+	closeOnce sync.Once
+}
+
+// Close stops the stream. Results of the providers still running are
+// discarded.
+func (ss *SearchStream) Close() {
+	ss.closeOnce.Do(func() {
+		close(ss.closing)
+	})
+}
+
+func StreamMovie(searchers []MovieSearcher, movie *tmdb.Movie) *SearchStream {
+	return streamLinks(len(searchers), func(i int) []*bittorrent.Torrent {
+		return searchers[i].SearchMovieLinks(movie)
+	}, movie.Runtime, movieLinksFilter(movie))
+}
+
+func StreamEpisode(searchers []EpisodeSearcher, show *tvdb.Show, episode *tvdb.Episode) *SearchStream {
+	return streamLinks(len(searchers), func(i int) []*bittorrent.Torrent {
+		return searchers[i].SearchEpisodeLinks(show, episode)
+	}, show.Runtime, nil)
+}
+
+// streamLinks runs search for each of the count providers, and ranks their
+// results as soon as each provider answers, concurrently so that a slow
+// scrape doesn't hold back the other batches. Torrents already sent by a
+// previous provider are skipped. filter is like the one of processLinks.
+func streamLinks(count int, search func(i int) []*bittorrent.Torrent, runtime int, filter func(torrents []*bittorrent.Torrent) []*bittorrent.Torrent) *SearchStream {
+	batches := make(chan []*bittorrent.Torrent)
+	results := make(chan []*bittorrent.Torrent)
+	ss := &SearchStream{
+		Results: results,
+		closing: make(chan struct{}),
+	}
+
+	go func() {
+		wg := sync.WaitGroup{}
+		for i := 0; i < count; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				torrents := resolveTorrents(search(i))
+				if filter != nil {
+					torrents = filter(torrents)
+				}
+				select {
+				case <-ss.closing:
+					return
+				default:
+				}
+				torrents = rankTorrents(mergeTorrents(torrents), runtime)
+				select {
+				case batches <- torrents:
+				case <-ss.closing:
+				}
+			}(i)
+		}
+		wg.Wait()
+		close(batches)
+	}()
+
+	go func() {
+		defer close(results)
+		sent := map[string]bool{}
+		for batch := range batches {
+			torrents := make([]*bittorrent.Torrent, 0, len(batch))
+			for _, torrent := range batch {
+				if sent[torrent.InfoHash] == false {
+					sent[torrent.InfoHash] = true
+					torrents = append(torrents, torrent)
+				}
+			}
+			if len(torrents) == 0 {
+				continue
+			}
+			select {
+			case results <- torrents:
+			case <-ss.closing:
+			}
+		}
+	}()
+
+	return ss
+}
@@ -0,0 +1,232 @@
+package providers
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/steeve/pulsar/bittorrent"
+	"github.com/steeve/pulsar/config"
+	"github.com/steeve/pulsar/tmdb"
+	"github.com/steeve/pulsar/tvdb"
+)
+
+const (
+	torznabProviderName = "torznab"
+
+	torznabMoviesCategory = "2000"
+	torznabTVCategory     = "5000"
+)
+
+type torznabAttr struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type torznabItem struct {
+	Title     string `xml:"title"`
+	Link      string `xml:"link"`
+	Size      int64  `xml:"size"`
+	Enclosure struct {
+		URL    string `xml:"url,attr"`
+		Length int64  `xml:"length,attr"`
+	} `xml:"enclosure"`
+	Attrs []torznabAttr `xml:"attr"`
+}
+
+type torznabResponse struct {
+	XMLName xml.Name
+	Items   []torznabItem `xml:"channel>item"`
+	// set on <error code="" description=""/> responses
+	Code        int    `xml:"code,attr"`
+	Description string `xml:"description,attr"`
+}
+
+// TorznabSearcher queries the Torznab endpoints (Jackett, NZBHydra...)
+// configured in the settings. Endpoints are API URLs including their apikey
+// parameter, e.g. http://localhost:9117/api/v2.0/indexers/all/results/torznab/api?apikey=xxx
+type TorznabSearcher struct{}
+
+func init() {
+	Register(torznabProviderName, &TorznabSearcher{})
+}
+
+func (ts *TorznabSearcher) Configured() bool {
+	return len(config.Get().TorznabEndpoints) > 0
+}
+
+func (ts *TorznabSearcher) SearchLinks(query string) []*bittorrent.Torrent {
+	return ts.search(url.Values{
+		"t": {"search"},
+		"q": {query},
+	})
+}
+
+func (ts *TorznabSearcher) SearchMovieLinks(movie *tmdb.Movie) []*bittorrent.Torrent {
+	if movie.IMDBId == "" {
+		return ts.SearchLinks(movie.Title)
+	}
+	return ts.search(url.Values{
+		"t":      {"movie"},
+		"imdbid": {strings.TrimPrefix(movie.IMDBId, "tt")},
+		"cat":    {torznabMoviesCategory},
+	})
+}
+
+// SearchEpisodeLinks keeps the results that are the episode, since indexers
+// often ignore the season and episode parameters.
+func (ts *TorznabSearcher) SearchEpisodeLinks(show *tvdb.Show, episode *tvdb.Episode) []*bittorrent.Torrent {
+	torrents := ts.search(url.Values{
+		"t":      {"tvsearch"},
+		"tvdbid": {strconv.Itoa(show.Id)},
+		"season": {strconv.Itoa(episode.SeasonNumber)},
+		"ep":     {strconv.Itoa(episode.EpisodeNumber)},
+		"cat":    {torznabTVCategory},
+	})
+	matches := episodeMatcher(show, episode, isAnime(show, nil))
+
+	episodes := make([]*bittorrent.Torrent, 0, len(torrents))
+	for _, torrent := range torrents {
+		if matches(torrent.Release) {
+			episodes = append(episodes, torrent)
+		}
+	}
+	if len(episodes) < len(torrents) {
+		log.Info("Filtered %d irrelevant items\n", len(torrents)-len(episodes))
+	}
+	return episodes
+}
+
+func (ts *TorznabSearcher) SearchSeasonLinks(show *tvdb.Show, season *tvdb.Season) []*bittorrent.Torrent {
+	return filterSeasonPacks(ts.search(url.Values{
+		"t":      {"tvsearch"},
+		"tvdbid": {strconv.Itoa(show.Id)},
+		"season": {strconv.Itoa(season.Season)},
+		"cat":    {torznabTVCategory},
+	}), season.Season)
+}
+
+// search runs the query on all the endpoints at once.
+func (ts *TorznabSearcher) search(params url.Values) []*bittorrent.Torrent {
+	endpoints := config.Get().TorznabEndpoints
+	timeout := providerSearchTimeout(torznabProviderName)
+	results := make(chan []*bittorrent.Torrent, len(endpoints))
+	wg := sync.WaitGroup{}
+	for _, endpoint := range endpoints {
+		wg.Add(1)
+		go func(endpoint string) {
+			defer wg.Done()
+			torrents, err := torznabSearch(endpoint, params, timeout)
+			if err != nil {
+				log.Error("Torznab search on %s failed: %s\n", torznabHost(endpoint), err)
+				return
+			}
+			results <- torrents
+		}(endpoint)
+	}
+	wg.Wait()
+	close(results)
+
+	torrents := make([]*bittorrent.Torrent, 0)
+	for result := range results {
+		torrents = append(torrents, result...)
+	}
+	return torrents
+}
+
+// torznabHost returns the host of endpoint, so that api keys don't end up in
+// the logs.
+func torznabHost(endpoint string) string {
+	if u, err := url.Parse(endpoint); err == nil {
+		return u.Host
+	}
+	return "invalid endpoint"
+}
+
+func torznabSearch(endpoint string, params url.Values, timeout time.Duration) ([]*bittorrent.Torrent, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	query := u.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	u.RawQuery = query.Encode()
+
+	client := &http.Client{Timeout: timeout}
+	resp, err := client.Get(u.String())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New(resp.Status)
+	}
+
+	response := torznabResponse{}
+	if err := xml.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, err
+	}
+	if response.XMLName.Local == "error" {
+		return nil, fmt.Errorf("error %d: %s", response.Code, response.Description)
+	}
+
+	torrents := make([]*bittorrent.Torrent, 0, len(response.Items))
+	for _, item := range response.Items {
+		if torrent := item.torrent(); torrent != nil {
+			torrents = append(torrents, torrent)
+		}
+	}
+	return torrents, nil
+}
+
+func torznabAttrs(list []torznabAttr) map[string]string {
+	attrs := make(map[string]string)
+	for _, attr := range list {
+		attrs[attr.Name] = attr.Value
+	}
+	return attrs
+}
+
+// torrent converts a feed item. Torznab peers include the seeders, unlike
+// ours which are only the leechers.
+func (item *torznabItem) torrent() *bittorrent.Torrent {
+	attrs := torznabAttrs(item.Attrs)
+
+	torrent := &bittorrent.Torrent{
+		URI:      attrs["magneturl"],
+		InfoHash: strings.ToLower(attrs["infohash"]),
+		Name:     item.Title,
+		Size:     item.Size,
+	}
+	if torrent.URI == "" {
+		torrent.URI = item.Enclosure.URL
+	}
+	if torrent.URI == "" {
+		torrent.URI = item.Link
+	}
+	if torrent.URI == "" {
+		return nil
+	}
+	if torrent.Size == 0 {
+		torrent.Size = item.Enclosure.Length
+	}
+	if size, err := strconv.ParseInt(attrs["size"], 10, 64); err == nil && torrent.Size == 0 {
+		torrent.Size = size
+	}
+	torrent.Seeds, _ = strconv.ParseInt(attrs["seeders"], 10, 64)
+	if leechers, err := strconv.ParseInt(attrs["leechers"], 10, 64); err == nil {
+		torrent.Peers = leechers
+	} else if peers, err := strconv.ParseInt(attrs["peers"], 10, 64); err == nil && peers > torrent.Seeds {
+		torrent.Peers = peers - torrent.Seeds
+	}
+	torrent.Initialize()
+	return torrent
+}
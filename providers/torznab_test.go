@@ -0,0 +1,193 @@
+package providers
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/steeve/pulsar/config"
+	"github.com/steeve/pulsar/tvdb"
+)
+
+type torznabTestItem struct {
+	title    string
+	infoHash string
+	seeders  int
+	peers    int
+}
+
+func torznabFeed(items ...torznabTestItem) string {
+	feed := `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0" xmlns:torznab="http://torznab.com/schemas/2015/feed"><channel>`
+	for _, item := range items {
+		feed += fmt.Sprintf(`<item>
+	<title>%s</title>
+	<link>http://indexer.example.org/dl/%s</link>
+	<size>1073741824</size>
+	<enclosure url="http://indexer.example.org/dl/%s.torrent" length="1073741824" type="application/x-bittorrent"/>
+	<torznab:attr name="infohash" value="%s"/>
+	<torznab:attr name="seeders" value="%d"/>
+	<torznab:attr name="peers" value="%d"/>
+</item>`, item.title, item.infoHash, item.infoHash, item.infoHash, item.seeders, item.peers)
+	}
+	return feed + `</channel></rss>`
+}
+
+// withTestConfig runs test with a configuration changed by setup, and a
+// temporary profile.
+func withTestConfig(t *testing.T, setup func(conf *config.Configuration), test func()) {
+	profile, err := ioutil.TempDir("", "pulsar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(profile)
+
+	conf := config.Get()
+	saved := *conf
+	defer func() {
+		*conf = saved
+		providersStatsLock.Lock()
+		providersStats = nil
+		providersStatsLock.Unlock()
+	}()
+	conf.ProfilePath = profile
+	setup(conf)
+	test()
+}
+
+func TestTorznabSearch(t *testing.T) {
+	var query url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+		fmt.Fprint(w, torznabFeed(torznabTestItem{"The.Matrix.1999.1080p.BluRay.x264-GRP", strings.Repeat("AB", 20), 10, 15}))
+	}))
+	defer server.Close()
+
+	torrents, err := torznabSearch(server.URL+"/api?apikey=secret", url.Values{"t": {"movie"}, "imdbid": {"0133093"}}, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if query.Get("apikey") != "secret" || query.Get("t") != "movie" || query.Get("imdbid") != "0133093" {
+		t.Errorf("got query %v", query)
+	}
+	if len(torrents) != 1 {
+		t.Fatalf("got %d torrents, want 1", len(torrents))
+	}
+	torrent := torrents[0]
+	if torrent.URI != "http://indexer.example.org/dl/"+strings.Repeat("AB", 20)+".torrent" {
+		t.Errorf("got URI %s, want the enclosure", torrent.URI)
+	}
+	if torrent.InfoHash != strings.Repeat("ab", 20) {
+		t.Errorf("got info hash %s", torrent.InfoHash)
+	}
+	if torrent.Seeds != 10 || torrent.Peers != 5 {
+		t.Errorf("got %d seeds and %d peers, want 10 and 5", torrent.Seeds, torrent.Peers)
+	}
+	if torrent.Size != 1073741824 {
+		t.Errorf("got size %d", torrent.Size)
+	}
+	if torrent.Release == nil || torrent.Release.Title != "The Matrix" {
+		t.Errorf("release name wasn't parsed: %+v", torrent.Release)
+	}
+}
+
+func TestTorznabSearchErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+	}{
+		{"error response", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?><error code="100" description="Incorrect user credentials"/>`)
+		}},
+		{"HTTP error", func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "down", http.StatusServiceUnavailable)
+		}},
+		{"invalid XML", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, "<rss><channel>")
+		}},
+		{"timeout", func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(500 * time.Millisecond)
+			fmt.Fprint(w, torznabFeed())
+		}},
+	}
+	for _, test := range tests {
+		server := httptest.NewServer(test.handler)
+		if _, err := torznabSearch(server.URL, url.Values{}, 100*time.Millisecond); err == nil {
+			t.Errorf("%s: got no error", test.name)
+		}
+		server.Close()
+	}
+}
+
+func TestTorznabSearchEpisodeLinks(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// indexers often ignore the episode
+		fmt.Fprint(w, torznabFeed(
+			torznabTestItem{"Show.S01E01.720p.HDTV.x264-GRP", strings.Repeat("01", 20), 10, 10},
+			torznabTestItem{"Show.S01E02.720p.HDTV.x264-GRP", strings.Repeat("02", 20), 10, 10},
+			torznabTestItem{"Show.S02E01.720p.HDTV.x264-GRP", strings.Repeat("03", 20), 10, 10},
+			torznabTestItem{"Show.S01.720p.HDTV.x264-GRP", strings.Repeat("04", 20), 10, 10},
+		))
+	}))
+	defer server.Close()
+
+	episode := &tvdb.Episode{SeasonNumber: 1, EpisodeNumber: 1}
+	show := &tvdb.Show{
+		Id:         1,
+		SeriesName: "Show",
+		Seasons: tvdb.SeasonList{
+			{Season: 1, Episodes: tvdb.EpisodeList{episode, {SeasonNumber: 1, EpisodeNumber: 2}}},
+			{Season: 2, Episodes: tvdb.EpisodeList{{SeasonNumber: 2, EpisodeNumber: 1}}},
+		},
+	}
+
+	withTestConfig(t, func(conf *config.Configuration) {
+		conf.TorznabEndpoints = []string{server.URL}
+	}, func() {
+		torrents := (&TorznabSearcher{}).SearchEpisodeLinks(show, episode)
+		if len(torrents) != 1 || torrents[0].InfoHash != strings.Repeat("01", 20) {
+			t.Errorf("got %d torrents, want S01E01 only", len(torrents))
+		}
+	})
+}
+
+func TestTorznabTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(5 * time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name            string
+		customTimeout   int
+		providerTimeout int
+	}{
+		{"custom timeout", 1, 0},
+		{"provider timeout", 10, 1},
+	}
+	for _, test := range tests {
+		withTestConfig(t, func(conf *config.Configuration) {
+			conf.TorznabEndpoints = []string{server.URL}
+			conf.CustomProviderTimeoutEnabled = true
+			conf.CustomProviderTimeout = test.customTimeout
+		}, func() {
+			if test.providerTimeout > 0 {
+				SetProviderTimeout(torznabProviderName, test.providerTimeout)
+			}
+			started := time.Now()
+			(&TorznabSearcher{}).SearchLinks("query")
+			if elapsed := time.Since(started); elapsed > 3*time.Second {
+				t.Errorf("%s: search took %s, want about 1s", test.name, elapsed)
+			}
+		})
+	}
+}
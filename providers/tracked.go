@@ -0,0 +1,73 @@
+package providers
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/steeve/pulsar/bittorrent"
+	"github.com/steeve/pulsar/tmdb"
+	"github.com/steeve/pulsar/tvdb"
+)
+
+// trackedSearcher wraps a provider, addon or native, so that its searches are
+// recorded in its stats, and given up on after its timeout. It implements all
+// the searcher interfaces, but is only handed out for those provider does.
+type trackedSearcher struct {
+	name     string
+	provider interface{}
+}
+
+// failingSearcher is implemented by the providers able to tell why their
+// last search failed, like addons.
+type failingSearcher interface {
+	lastError() error
+}
+
+func (ts *trackedSearcher) SearchLinks(query string) []*bittorrent.Torrent {
+	return ts.track(func() []*bittorrent.Torrent {
+		return ts.provider.(Searcher).SearchLinks(query)
+	})
+}
+
+func (ts *trackedSearcher) SearchMovieLinks(movie *tmdb.Movie) []*bittorrent.Torrent {
+	return ts.track(func() []*bittorrent.Torrent {
+		return ts.provider.(MovieSearcher).SearchMovieLinks(movie)
+	})
+}
+
+func (ts *trackedSearcher) SearchEpisodeLinks(show *tvdb.Show, episode *tvdb.Episode) []*bittorrent.Torrent {
+	return ts.track(func() []*bittorrent.Torrent {
+		return ts.provider.(EpisodeSearcher).SearchEpisodeLinks(show, episode)
+	})
+}
+
+func (ts *trackedSearcher) SearchSeasonLinks(show *tvdb.Show, season *tvdb.Season) []*bittorrent.Torrent {
+	return ts.track(func() []*bittorrent.Torrent {
+		return ts.provider.(SeasonSearcher).SearchSeasonLinks(show, season)
+	})
+}
+
+func (ts *trackedSearcher) track(search func() []*bittorrent.Torrent) []*bittorrent.Torrent {
+	timeout := providerSearchTimeout(ts.name)
+	started := time.Now()
+
+	// buffered, so that late searches don't leak
+	results := make(chan []*bittorrent.Torrent, 1)
+	go func() {
+		results <- search()
+	}()
+
+	select {
+	case torrents := <-results:
+		var err error
+		if fs, ok := ts.provider.(failingSearcher); ok {
+			err = fs.lastError()
+		}
+		recordProviderResult(ts.name, time.Since(started), len(torrents), err)
+		return torrents
+	case <-time.After(timeout):
+		log.Info("Provider %s was too slow. Ignored.\n", ts.name)
+		recordProviderResult(ts.name, time.Since(started), 0, fmt.Errorf("timed out after %s", timeout))
+		return []*bittorrent.Torrent{}
+	}
+}
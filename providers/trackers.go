@@ -0,0 +1,156 @@
+package providers
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/steeve/pulsar/bittorrent"
+	"github.com/steeve/pulsar/cache"
+	"github.com/steeve/pulsar/config"
+)
+
+const (
+	trackersHealthKey       = "io.steeve.pulsar.trackers"
+	trackersHealthCacheTime = 100 * 365 * 24 * time.Hour // 100 years
+
+	// Trackers failing that many times in a row are only retried once per
+	// trackerRetryInterval.
+	trackerMaxConsecutiveFailures = 5
+	trackerRetryInterval          = 24 * time.Hour
+
+	// weight of the last sample in the latency moving average
+	trackerLatencySmoothing = 0.3
+)
+
+// TrackerHealth is the scrape history of a tracker. It's keyed, and its URL
+// is shown, without passkeys, so it can be saved and served as is.
+type TrackerHealth struct {
+	URL                 string    `json:"url"`
+	Successes           int       `json:"successes"`
+	Failures            int       `json:"failures"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	AverageLatencyMs    int64     `json:"average_latency_ms"`
+	LastError           string    `json:"last_error,omitempty"`
+	LastSuccess         time.Time `json:"last_success"`
+	LastChecked         time.Time `json:"last_checked"`
+}
+
+type ByTrackerHealth []*TrackerHealth
+
+func (a ByTrackerHealth) Len() int      { return len(a) }
+func (a ByTrackerHealth) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a ByTrackerHealth) Less(i, j int) bool {
+	if a[i].SuccessRate() != a[j].SuccessRate() {
+		return a[i].SuccessRate() < a[j].SuccessRate()
+	}
+	return a[i].AverageLatencyMs > a[j].AverageLatencyMs
+}
+
+var (
+	trackersHealthLock = sync.RWMutex{}
+	trackersHealth     map[string]*TrackerHealth
+)
+
+func (th *TrackerHealth) SuccessRate() float64 {
+	total := th.Successes + th.Failures
+	if total == 0 {
+		return 0
+	}
+	return float64(th.Successes) / float64(total)
+}
+
+// IsDead returns true when the tracker kept failing recently and shouldn't
+// be scraped until trackerRetryInterval has elapsed.
+func (th *TrackerHealth) IsDead() bool {
+	return th.ConsecutiveFailures >= trackerMaxConsecutiveFailures &&
+		time.Since(th.LastChecked) < trackerRetryInterval
+}
+
+func trackersHealthStore() cache.CacheStore {
+	return cache.NewFileStore(config.Get().ProfilePath)
+}
+
+// must be called with trackersHealthLock held
+func loadTrackersHealth() {
+	if trackersHealth != nil {
+		return
+	}
+	trackersHealth = make(map[string]*TrackerHealth)
+	saved := make(map[string]*TrackerHealth)
+	if err := trackersHealthStore().Get(trackersHealthKey, &saved); err != nil {
+		return
+	}
+	// profiles saved by older versions are keyed by full URLs
+	for _, th := range saved {
+		th.URL = bittorrent.RedactTrackerURL(th.URL)
+		if existing, ok := trackersHealth[th.URL]; ok && existing.LastChecked.After(th.LastChecked) {
+			continue
+		}
+		trackersHealth[th.URL] = th
+	}
+}
+
+func saveTrackersHealth() {
+	trackersHealthLock.RLock()
+	defer trackersHealthLock.RUnlock()
+	if err := trackersHealthStore().Set(trackersHealthKey, trackersHealth, trackersHealthCacheTime); err != nil {
+		log.Error("Unable to save trackers health: %s", err)
+	}
+}
+
+func isTrackerDead(trackerUrl string) bool {
+	trackerUrl = bittorrent.RedactTrackerURL(trackerUrl)
+	trackersHealthLock.Lock()
+	defer trackersHealthLock.Unlock()
+	loadTrackersHealth()
+	if th, ok := trackersHealth[trackerUrl]; ok {
+		return th.IsDead()
+	}
+	return false
+}
+
+func recordTrackerResult(trackerUrl string, latency time.Duration, err error) {
+	trackerUrl = bittorrent.RedactTrackerURL(trackerUrl)
+	trackersHealthLock.Lock()
+	defer trackersHealthLock.Unlock()
+	loadTrackersHealth()
+
+	th, ok := trackersHealth[trackerUrl]
+	if !ok {
+		th = &TrackerHealth{URL: trackerUrl}
+		trackersHealth[trackerUrl] = th
+	}
+	th.LastChecked = time.Now()
+	if err != nil {
+		th.Failures++
+		th.ConsecutiveFailures++
+		th.LastError = err.Error()
+		return
+	}
+	latencyMs := int64(latency / time.Millisecond)
+	if th.Successes == 0 {
+		th.AverageLatencyMs = latencyMs
+	} else {
+		th.AverageLatencyMs = int64(trackerLatencySmoothing*float64(latencyMs) + (1-trackerLatencySmoothing)*float64(th.AverageLatencyMs))
+	}
+	th.Successes++
+	th.ConsecutiveFailures = 0
+	th.LastSuccess = th.LastChecked
+}
+
+// GetTrackersHealth returns a copy of the known trackers health, healthiest
+// first.
+func GetTrackersHealth() []*TrackerHealth {
+	trackersHealthLock.Lock()
+	defer trackersHealthLock.Unlock()
+	loadTrackersHealth()
+
+	list := make([]*TrackerHealth, 0, len(trackersHealth))
+	for _, th := range trackersHealth {
+		thCopy := *th
+		list = append(list, &thCopy)
+	}
+	sort.Sort(sort.Reverse(ByTrackerHealth(list)))
+	return list
+}
@@ -0,0 +1,156 @@
+package providers
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/steeve/pulsar/bittorrent"
+	"github.com/steeve/pulsar/cache"
+	"github.com/steeve/pulsar/config"
+)
+
+const (
+	// number of best candidates whose metadata is inspected
+	verifyCandidates = 5
+	verdictCacheTime = 30 * 24 * time.Hour
+	// how long to wait for the metadata of a magnet
+	verifyMetadataTimeout = 20 * time.Second
+)
+
+// torrentFiles fetches the files of a torrent. Magnets are only resolved by
+// torcache until SetFilesResolver is called.
+var torrentFiles = func(torrent *bittorrent.Torrent) ([]*bittorrent.TorrentFileInfo, error) {
+	return torrent.Files()
+}
+
+// SetFilesResolver sets how the files of the torrents are fetched when
+// verifying them, e.g. with BTService.TorrentFiles to get the metadata of
+// magnets from their peers.
+func SetFilesResolver(resolver func(torrent *bittorrent.Torrent, timeout time.Duration) ([]*bittorrent.TorrentFileInfo, error)) {
+	torrentFiles = func(torrent *bittorrent.Torrent) ([]*bittorrent.TorrentFileInfo, error) {
+		return resolver(torrent, verifyMetadataTimeout)
+	}
+}
+
+var videoExtensions = map[string]bool{
+	".mkv":  true,
+	".mp4":  true,
+	".m4v":  true,
+	".avi":  true,
+	".mov":  true,
+	".mpg":  true,
+	".mpeg": true,
+	".ts":   true,
+	".m2ts": true,
+	".vob":  true,
+	".ogm":  true,
+	".webm": true,
+	".flv":  true,
+}
+
+// Extensions that have no business in a movie or episode torrent. WMV and ASF
+// are there because they are the usual "install this codec" fakes.
+var suspiciousExtensions = map[string]bool{
+	".exe": true,
+	".scr": true,
+	".bat": true,
+	".cmd": true,
+	".com": true,
+	".msi": true,
+	".vbs": true,
+	".js":  true,
+	".jar": true,
+	".lnk": true,
+	".apk": true,
+	".dmg": true,
+	".rar": true,
+	".zip": true,
+	".7z":  true,
+	".r00": true,
+	".001": true,
+	".wmv": true,
+	".asf": true,
+}
+
+type verdict struct {
+	Fake   bool   `json:"fake"`
+	Reason string `json:"reason"`
+}
+
+func verdictCacheKey(infoHash string) string {
+	return fmt.Sprintf("io.steeve.pulsar.verdict.%s", infoHash)
+}
+
+// inspectFiles returns a verdict on a torrent from the files it contains: the
+// largest one must be a video, and there must be no executable or archive.
+func inspectFiles(files []*bittorrent.TorrentFileInfo) verdict {
+	var largest *bittorrent.TorrentFileInfo
+	for _, file := range files {
+		ext := strings.ToLower(filepath.Ext(file.Path))
+		if suspiciousExtensions[ext] {
+			return verdict{Fake: true, Reason: fmt.Sprintf("contains %s", path.Base(file.Path))}
+		}
+		if largest == nil || file.Length > largest.Length {
+			largest = file
+		}
+	}
+	if largest == nil {
+		return verdict{Fake: true, Reason: "empty torrent"}
+	}
+	if ext := strings.ToLower(filepath.Ext(largest.Path)); videoExtensions[ext] == false {
+		return verdict{Fake: true, Reason: fmt.Sprintf("largest file %s is not a video", path.Base(largest.Path))}
+	}
+	return verdict{}
+}
+
+// verifyTorrent fetches the metadata of torrent and returns its verdict,
+// cached per info hash. ok is false when the metadata couldn't be fetched.
+func verifyTorrent(cacheStore cache.CacheStore, torrent *bittorrent.Torrent) (v verdict, ok bool) {
+	key := verdictCacheKey(torrent.InfoHash)
+	if err := cacheStore.Get(key, &v); err == nil {
+		return v, true
+	}
+	files, err := torrentFiles(torrent)
+	if err != nil {
+		log.Info("Not verifying %s, unable to fetch its metadata: %s\n", torrent.Name, err)
+		return v, false
+	}
+	v = inspectFiles(files)
+	cacheStore.Set(key, v, verdictCacheTime)
+	return v, true
+}
+
+// verifyTorrents inspects the files of the best torrents and discards the
+// fakes. Torrents whose metadata isn't available are kept.
+func verifyTorrents(torrents []*bittorrent.Torrent) []*bittorrent.Torrent {
+	cacheStore := cache.NewFileStore(path.Join(config.Get().ProfilePath, "cache"))
+
+	count := verifyCandidates
+	if len(torrents) < count {
+		count = len(torrents)
+	}
+	verdicts := make([]verdict, count)
+	wg := sync.WaitGroup{}
+	for i, torrent := range torrents[:count] {
+		wg.Add(1)
+		go func(i int, torrent *bittorrent.Torrent) {
+			defer wg.Done()
+			verdicts[i], _ = verifyTorrent(cacheStore, torrent)
+		}(i, torrent)
+	}
+	wg.Wait()
+
+	verified := make([]*bittorrent.Torrent, 0, len(torrents))
+	for i, torrent := range torrents {
+		if i < count && verdicts[i].Fake {
+			log.Info("Discarding %s, %s\n", torrent.Name, verdicts[i].Reason)
+			continue
+		}
+		verified = append(verified, torrent)
+	}
+	return verified
+}
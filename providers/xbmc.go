@@ -1,11 +1,10 @@
 package providers
 
 import (
-	"encoding/json"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"io/ioutil"
-	"math/rand"
-	"regexp"
 	"strconv"
 	"strings"
 	"sync"
@@ -21,24 +20,27 @@ import (
 	"github.com/steeve/pulsar/xbmc"
 )
 
-const (
-	// if >= 80% of episodes have absolute numbers, assume it's because we need it
-	mixAbsoluteNumberPercentage = 0.8
-)
-
 type AddonSearcher struct {
 	MovieSearcher
 	EpisodeSearcher
 
 	addonId string
 	log     *logging.Logger
+
+	errLock sync.Mutex
+	err     error // why the last call failed
 }
 
 var cbLock = sync.RWMutex{}
 var callbacks = map[string]chan []byte{}
 
+// GetCallback returns a new callback id and the channel its body will be sent
+// on. Ids are random tokens, valid for a single call, so that other local
+// processes can't post results.
 func GetCallback() (string, chan []byte) {
-	cid := strconv.Itoa(rand.Int())
+	token := make([]byte, 16)
+	rand.Read(token)
+	cid := hex.EncodeToString(token)
 	c := make(chan []byte, 1) // make sure we don't block clients when we write on it
 	cbLock.Lock()
 	callbacks[cid] = c
@@ -69,11 +71,30 @@ func CallbackHandler(ctx *gin.Context) {
 	close(c)
 }
 
-func getSearchers() []interface{} {
-	list := make([]interface{}, 0)
+// GetAddonProviders returns the ids of the installed provider add-ons,
+// including the ones disabled in Pulsar.
+func GetAddonProviders() []string {
+	addonIds := make([]string, 0)
 	for _, addon := range xbmc.GetAddons("xbmc.python.script", "executable", true).Addons {
 		if strings.HasPrefix(addon.ID, "script.pulsar.") {
-			list = append(list, NewAddonSearcher(addon.ID))
+			addonIds = append(addonIds, addon.ID)
+		}
+	}
+	return addonIds
+}
+
+// getSearchers returns the enabled providers, addons first, wrapped so that
+// their searches are tracked.
+func getSearchers() []*trackedSearcher {
+	list := make([]*trackedSearcher, 0)
+	for _, addonId := range GetAddonProviders() {
+		if IsProviderEnabled(addonId) {
+			list = append(list, &trackedSearcher{name: addonId, provider: NewAddonSearcher(addonId)})
+		}
+	}
+	for _, name := range Registered() {
+		if IsProviderEnabled(name) {
+			list = append(list, &trackedSearcher{name: name, provider: registeredSearcher(name)})
 		}
 	}
 	return list
@@ -82,7 +103,12 @@ func getSearchers() []interface{} {
 func GetMovieSearchers() []MovieSearcher {
 	searchers := make([]MovieSearcher, 0)
 	for _, searcher := range getSearchers() {
-		searchers = append(searchers, searcher.(MovieSearcher))
+		if as, ok := searcher.provider.(*AddonSearcher); ok && as.Capabilities() != nil && as.Capabilities().Movie == false {
+			continue
+		}
+		if _, ok := searcher.provider.(MovieSearcher); ok {
+			searchers = append(searchers, searcher)
+		}
 	}
 	return searchers
 }
@@ -90,7 +116,28 @@ func GetMovieSearchers() []MovieSearcher {
 func GetEpisodeSearchers() []EpisodeSearcher {
 	searchers := make([]EpisodeSearcher, 0)
 	for _, searcher := range getSearchers() {
-		searchers = append(searchers, searcher.(EpisodeSearcher))
+		if as, ok := searcher.provider.(*AddonSearcher); ok && as.Capabilities() != nil && as.Capabilities().Episode == false {
+			continue
+		}
+		if _, ok := searcher.provider.(EpisodeSearcher); ok {
+			searchers = append(searchers, searcher)
+		}
+	}
+	return searchers
+}
+
+// GetSeasonSearchers returns the providers able to search for season packs.
+// Addons have to declare it in their capabilities, since older ones would
+// choke on the search_season method.
+func GetSeasonSearchers() []SeasonSearcher {
+	searchers := make([]SeasonSearcher, 0)
+	for _, searcher := range getSearchers() {
+		if as, ok := searcher.provider.(*AddonSearcher); ok && (as.Capabilities() == nil || as.Capabilities().Season == false) {
+			continue
+		}
+		if _, ok := searcher.provider.(SeasonSearcher); ok {
+			searchers = append(searchers, searcher)
+		}
 	}
 	return searchers
 }
@@ -98,7 +145,9 @@ func GetEpisodeSearchers() []EpisodeSearcher {
 func GetSearchers() []Searcher {
 	searchers := make([]Searcher, 0)
 	for _, searcher := range getSearchers() {
-		searchers = append(searchers, searcher.(Searcher))
+		if _, ok := searcher.provider.(Searcher); ok {
+			searchers = append(searchers, searcher)
+		}
 	}
 	return searchers
 }
@@ -110,6 +159,12 @@ func NewAddonSearcher(addonId string) *AddonSearcher {
 	}
 }
 
+// Capabilities returns what the provider declared it supports, nil if it
+// never did, like version 1 providers.
+func (as *AddonSearcher) Capabilities() *ProviderCapabilities {
+	return GetProviderStats(as.addonId).Capabilities
+}
+
 func (as *AddonSearcher) GetMovieSearchObject(movie *tmdb.Movie) *MovieSearchObject {
 	year, _ := strconv.Atoi(strings.Split(movie.ReleaseDate, "-")[0])
 	title := movie.OriginalTitle
@@ -128,57 +183,126 @@ func (as *AddonSearcher) GetMovieSearchObject(movie *tmdb.Movie) *MovieSearchObj
 	return sObject
 }
 
-func (as *AddonSearcher) GetEpisodeSearchObject(show *tvdb.Show, episode *tvdb.Episode) *EpisodeSearchObject {
-	seriesName := show.SeriesName
-	absoluteNumber := 0
-	tmdbFindResults := tmdb.Find(strconv.Itoa(show.Id), "tvdb_id")
-
-	// FIXME: This can crash
-	if tmdbFindResults != nil {
-		var tmdbShow *tmdb.Show
+// getTMDBShow returns the english TMDB show of a TheTVDB show, or nil.
+func getTMDBShow(show *tvdb.Show) *tmdb.Show {
+	if tmdbFindResults := tmdb.Find(strconv.Itoa(show.Id), "tvdb_id"); tmdbFindResults != nil {
 		for _, result := range tmdbFindResults.TVResults {
-			tmdbShow = tmdb.GetShow(result.Id, "en")
-			break
+			return tmdb.GetShow(result.Id, "en")
 		}
-		if tmdbShow != nil {
-			seriesName = tmdbShow.Name
+	}
+	return nil
+}
+
+// getShowTitles returns the alternative titles of a show by lowercase country
+// code, plus "original", and its translated titles by language code.
+// Translations come from TMDB, and from TheTVDB for the languages the user
+// searches in.
+func getShowTitles(show *tvdb.Show, tmdbShow *tmdb.Show) (titles map[string]string, languages map[string]string) {
+	titles = make(map[string]string)
+	languages = make(map[string]string)
+	if tmdbShow != nil {
+		if tmdbShow.AlternativeTitles != nil {
+			for _, title := range tmdbShow.AlternativeTitles.Titles {
+				titles[strings.ToLower(title.ISO_3166_1)] = NormalizeTitle(title.Title)
+			}
 		}
-		// is this an anime?
-		countryIsJP := false
-		for _, country := range tmdbShow.OriginCountry {
-			if country == "JP" {
-				countryIsJP = true
-				break
+		if tmdbShow.OriginalName != "" {
+			titles["original"] = NormalizeTitle(tmdbShow.OriginalName)
+		}
+		if tmdbShow.Translations != nil {
+			for _, translation := range tmdbShow.Translations.Translations {
+				if translation.Data != nil && translation.Data.Name != "" {
+					languages[translation.ISO_639_1] = NormalizeTitle(translation.Data.Name)
+				}
 			}
 		}
-		genreIsAnim := false
-		for _, genre := range tmdbShow.Genres {
-			if genre.Name == "Animation" {
-				genreIsAnim = true
-				break
+	}
+
+	// show is in the language of the user
+	showLanguage := show.Language
+	if showLanguage == "" {
+		showLanguage = config.Get().Language
+	}
+	for _, language := range searchLanguages() {
+		name := show.SeriesName
+		if language != showLanguage {
+			translated, err := tvdb.NewShowCached(strconv.Itoa(show.Id), language)
+			if err != nil {
+				continue
 			}
+			name = translated.SeriesName
 		}
-		if countryIsJP && genreIsAnim {
-			absoluteNumber = episode.AbsoluteNumber
+		if name != "" {
+			languages[language] = NormalizeTitle(name)
 		}
 	}
+	return titles, languages
+}
+
+// searchLanguages returns the languages the user searches in: the one of the
+// interface, and the preferred audio languages.
+func searchLanguages() []string {
+	conf := config.Get()
+	languages := make([]string, 0, len(conf.AudioLanguages)+1)
+	for _, language := range append([]string{conf.Language}, conf.AudioLanguages...) {
+		if len(language) == 2 && containsString(languages, language) == false {
+			languages = append(languages, language)
+		}
+	}
+	return languages
+}
+
+func (as *AddonSearcher) GetEpisodeSearchObject(show *tvdb.Show, episode *tvdb.Episode) *EpisodeSearchObject {
+	seriesName := show.SeriesName
+	tmdbShow := getTMDBShow(show)
+	if tmdbShow != nil {
+		seriesName = tmdbShow.Name
+	}
+
+	titles, languages := getShowTitles(show, tmdbShow)
+	numbering := getSceneNumbering(show, episode)
+	absoluteNumber := 0
+	if isAnime(show, tmdbShow) {
+		absoluteNumber = numbering.Absolute
+	}
 
 	return &EpisodeSearchObject{
 		IMDBId:         show.ImdbId,
 		TVDBId:         show.Id,
 		Title:          NormalizeTitle(seriesName),
-		Season:         episode.SeasonNumber,
-		Episode:        episode.EpisodeNumber,
+		Season:         numbering.Season,
+		Episode:        numbering.Episode,
+		Titles:         titles,
+		Languages:      languages,
 		AbsoluteNumber: absoluteNumber,
 	}
 }
 
+func (as *AddonSearcher) GetSeasonSearchObject(show *tvdb.Show, season *tvdb.Season) *SeasonSearchObject {
+	seriesName := show.SeriesName
+	tmdbShow := getTMDBShow(show)
+	if tmdbShow != nil {
+		seriesName = tmdbShow.Name
+	}
+	titles, languages := getShowTitles(show, tmdbShow)
+	return &SeasonSearchObject{
+		IMDBId:       show.ImdbId,
+		TVDBId:       show.Id,
+		Title:        NormalizeTitle(seriesName),
+		Season:       season.Season,
+		EpisodeCount: len(season.Episodes),
+		Titles:       titles,
+		Languages:    languages,
+	}
+}
+
 func (as *AddonSearcher) call(method string, searchObject interface{}) []*bittorrent.Torrent {
 	torrents := make([]*bittorrent.Torrent, 0)
 	cid, c := GetCallback()
 	cbUrl := fmt.Sprintf("%s/callbacks/%s", util.GetHTTPHost(), cid)
 
 	payload := &SearchPayload{
+		Version:      ProtocolVersion,
 		Method:       method,
 		CallbackURL:  cbUrl,
 		SearchObject: searchObject,
@@ -186,45 +310,74 @@ func (as *AddonSearcher) call(method string, searchObject interface{}) []*bittor
 
 	xbmc.ExecuteAddon(as.addonId, payload.String())
 
-	timeout := providerTimeout()
-	conf := config.Get()
-	if conf.CustomProviderTimeoutEnabled == true {
-		timeout = time.Duration(conf.CustomProviderTimeout) * time.Second
-	}
+	// trackedSearcher gives up at the same time, this only frees the callback
+	timeout := providerSearchTimeout(as.addonId)
 
+	as.setError(nil)
 	select {
 	case <-time.After(timeout):
-		as.log.Info("Provider %s was too slow. Ignored.", as.addonId)
 		RemoveCallback(cid)
+		as.setError(fmt.Errorf("timed out after %s", timeout))
 	case result := <-c:
-		json.Unmarshal(result, &torrents)
+		response, err := ParseSearchResponse(result)
+		if err != nil {
+			as.log.Info("Provider %s returned invalid results: %s", as.addonId, err)
+			as.setError(err)
+			break
+		}
+		if response.Capabilities != nil {
+			setProviderCapabilities(as.addonId, response.Capabilities)
+		}
+		if response.Error != nil {
+			as.log.Info("Provider %s failed: %s", as.addonId, response.Error)
+			as.setError(response.Error)
+			break
+		}
+		if response.Results != nil {
+			torrents = response.Results
+		}
 	}
 
 	return torrents
 }
 
+func (as *AddonSearcher) setError(err error) {
+	as.errLock.Lock()
+	defer as.errLock.Unlock()
+	as.err = err
+}
+
+func (as *AddonSearcher) lastError() error {
+	as.errLock.Lock()
+	defer as.errLock.Unlock()
+	return as.err
+}
+
 func (as *AddonSearcher) SearchLinks(query string) []*bittorrent.Torrent {
 	return as.call("search", query)
 }
 
+// SearchMovieLinks returns the results of the addon as is, they're filtered
+// by SearchMovie like those of every provider.
 func (as *AddonSearcher) SearchMovieLinks(movie *tmdb.Movie) []*bittorrent.Torrent {
 	return as.call("search_movie", as.GetMovieSearchObject(movie))
 }
 
+// SearchMovieLinksDiscarded is SearchMovieLinks, but splits the results
+// between those SearchMovie keeps and those it filters out because they don't
+// match the movie.
+func (as *AddonSearcher) SearchMovieLinksDiscarded(movie *tmdb.Movie) ([]*bittorrent.Torrent, []*DiscardedTorrent) {
+	return filterMovieLinks(movie, as.SearchMovieLinks(movie))
+}
+
 func (as *AddonSearcher) SearchEpisodeLinks(show *tvdb.Show, episode *tvdb.Episode) []*bittorrent.Torrent {
 	epSearchObject := as.GetEpisodeSearchObject(show, episode)
 	torrents := as.call("search_episode", epSearchObject)
-	epMatch := regexp.MustCompile(fmt.Sprintf("(s%02de%02d|%dx%02d)",
-		epSearchObject.Season, epSearchObject.Episode,
-		epSearchObject.Season, epSearchObject.Episode))
-	if epSearchObject.AbsoluteNumber > 0 {
-		epMatch = regexp.MustCompile(fmt.Sprintf("%02d", epSearchObject.AbsoluteNumber))
-	}
+	matches := episodeMatcher(show, episode, epSearchObject.AbsoluteNumber > 0)
 
 	cleanTorrents := make([]*bittorrent.Torrent, 0)
 	for _, torrent := range torrents {
-		lowerName := strings.ToLower(torrent.Name)
-		if epMatch.MatchString(lowerName) {
+		if matches(bittorrent.ParseReleaseName(torrent.Name)) {
 			cleanTorrents = append(cleanTorrents, torrent)
 		}
 	}
@@ -235,3 +388,7 @@ func (as *AddonSearcher) SearchEpisodeLinks(show *tvdb.Show, episode *tvdb.Episo
 
 	return cleanTorrents
 }
+
+func (as *AddonSearcher) SearchSeasonLinks(show *tvdb.Show, season *tvdb.Season) []*bittorrent.Torrent {
+	return filterSeasonPacks(as.call("search_season", as.GetSeasonSearchObject(show, season)), season.Season)
+}
@@ -63,7 +63,8 @@ func getMovieById(movieId string, language string) *Movie {
 	var movie *Movie
 	cacheStore := cache.NewFileStore(path.Join(config.Get().ProfilePath, "cache"))
 	key := fmt.Sprintf("com.tmdb.movie.%s.%s", movieId, language)
-	if err := cacheStore.Get(key, &movie); err != nil {
+	cacheStore.Fetch(key, &movie, cacheTime, func() (interface{}, error) {
+		var movie *Movie
 		rateLimiter.Call(func() {
 			napping.Get(
 				tmdbEndpoint+"movie/"+movieId,
@@ -71,11 +72,12 @@ func getMovieById(movieId string, language string) *Movie {
 				&movie,
 				nil,
 			)
-			if movie != nil {
-				cacheStore.Set(key, movie, cacheTime)
-			}
 		})
-	}
+		if movie == nil {
+			return nil, nil
+		}
+		return movie, nil
+	})
 	if movie == nil {
 		return nil
 	}
@@ -36,7 +36,10 @@ type Show struct {
 	ProductionCompanies []*IdName    `json:"production_companies"`
 	Status              string       `json:"status"`
 	ExternalIDs         *ExternalIDs `json:"external_ids"`
-	Translations        *struct {
+	AlternativeTitles   *struct {
+		Titles []*AlternativeTitle `json:"results"`
+	} `json:"alternative_titles"`
+	Translations *struct {
 		Translations []*Language `json:"translations"`
 	} `json:"translations"`
 
@@ -50,7 +53,8 @@ func GetShow(showId int, language string) *Show {
 	var show *Show
 	cacheStore := cache.NewFileStore(path.Join(config.Get().ProfilePath, "cache"))
 	key := fmt.Sprintf("com.tmdb.show.%d.%s", showId, language)
-	if err := cacheStore.Get(key, &show); err != nil {
+	cacheStore.Fetch(key, &show, cacheTime, func() (interface{}, error) {
+		var show *Show
 		rateLimiter.Call(func() {
 			napping.Get(
 				tmdbEndpoint+"tv/"+strconv.Itoa(showId),
@@ -59,10 +63,11 @@ func GetShow(showId int, language string) *Show {
 				nil,
 			)
 		})
-		if show != nil {
-			cacheStore.Set(key, show, cacheTime)
+		if show == nil {
+			return nil, nil
 		}
-	}
+		return show, nil
+	})
 	if show == nil {
 		return nil
 	}
@@ -96,8 +96,15 @@ type AlternativeTitle struct {
 
 type Language struct {
 	ISO_639_1   string `json:"iso_639_1"`
+	ISO_3166_1  string `json:"iso_3166_1,omitempty"`
 	Name        string `json:"name"`
 	EnglishName string `json:"english_name,omitempty"`
+
+	// only set on translations
+	Data *struct {
+		Title string `json:"title"` // movies
+		Name  string `json:"name"`  // shows
+	} `json:"data,omitempty"`
 }
 
 type FindResult struct {
@@ -183,7 +190,8 @@ func Find(externalId string, externalSource string) *FindResult {
 
 	cacheStore := cache.NewFileStore(path.Join(config.Get().ProfilePath, "cache"))
 	key := fmt.Sprintf("com.tmdb.find.%s.%s", externalSource, externalId)
-	if err := cacheStore.Get(key, &result); err != nil {
+	cacheStore.Fetch(key, &result, 365*24*time.Hour, func() (interface{}, error) {
+		var result *FindResult
 		rateLimiter.Call(func() {
 			napping.Get(
 				tmdbEndpoint+"find/"+externalId,
@@ -191,9 +199,12 @@ func Find(externalId string, externalSource string) *FindResult {
 				&result,
 				nil,
 			)
-			cacheStore.Set(key, result, 365*24*time.Hour)
 		})
-	}
+		if result == nil {
+			return nil, nil
+		}
+		return result, nil
+	})
 
 	return result
 }
@@ -197,15 +197,19 @@ func NewShowCached(tvdbId string, language string) (*Show, error) {
 	var show *Show
 	cacheStore := cache.NewFileStore(path.Join(config.Get().ProfilePath, "cache"))
 	key := fmt.Sprintf("com.tvdb.show.%s.%s", tvdbId, language)
-	if err := cacheStore.Get(key, &show); err != nil {
-		newShow, err := NewShow(tvdbId, language)
-		if err != nil {
+	err := cacheStore.Fetch(key, &show, cacheTime, func() (interface{}, error) {
+		show, err := NewShow(tvdbId, language)
+		if err != nil || show == nil {
 			return nil, err
 		}
-		if newShow != nil {
-			cacheStore.Set(key, newShow, cacheTime)
-		}
-		show = newShow
+		return show, nil
+	})
+	// unknown shows aren't cached, and aren't errors
+	if err == cache.ErrNotStored {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
 	}
 	return show, nil
 }